@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"homenet/internal/api"
 	"homenet/internal/config"
 	"homenet/internal/dns"
 	"homenet/internal/models"
@@ -38,6 +40,7 @@ var (
 
 	onlineStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("42")) // Green
 	offlineStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241")) // Grey
+	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196")) // Red
 )
 
 // Model stores the application state
@@ -48,21 +51,32 @@ type model struct {
 	spinner   spinner.Model
 	devices   []models.Device
 	err       error
-	scanning  bool
+	progress  scanner.Progress
 	subTitle  string
 	alert     string
 	// Interaction
 	showDetails    bool
 	selectedDevice *models.Device
+	showStats      bool
+	showWarnings   bool
+	warnings       []models.SecurityAlert
+	dhcpServers    []models.DHCPServer
+	statsWindow    string
+	dnsStats       dns.StatsSnapshot
 	
 	// Stats
 	totalQueries   uint64
 	blockedQueries uint64
+	prefetches     uint64
+	prefetchHits   uint64
+	dnsState       string
+	dnsErr         error
 }
 
 type tickMsg time.Time
 type scanResultMsg []models.Device
 type alertMsg string
+type progressMsg scanner.Progress
 
 // Init is the first function that runs
 func (m model) Init() tea.Cmd {
@@ -71,6 +85,7 @@ func (m model) Init() tea.Cmd {
 		tickCmd(),
 		scanCmd(m.scanner),
 		waitForAlert(m.scanner),
+		waitForProgress(m.scanner),
 	)
 }
 
@@ -82,7 +97,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "q", "ctrl+c":
-			// Save on exit
+			// Finish the current scan, then save on exit
+			m.scanner.Stop()
 			m.scanner.SaveDevices()
 			return m, tea.Quit
 		case "enter":
@@ -98,23 +114,69 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.showDetails = true
 				}
 			}
+		case "s":
+			if !m.showDetails {
+				m.showStats = !m.showStats
+				m.showWarnings = false
+				m.refreshDNSStats()
+			}
+		case "w":
+			if !m.showDetails {
+				m.showWarnings = !m.showWarnings
+				m.showStats = false
+				m.warnings = m.scanner.Warnings()
+				m.dhcpServers = m.scanner.DHCPServers()
+			}
+		case "r":
+			m.scanner.ScanNow()
+		case "tab":
+			if m.showStats {
+				m.statsWindow = nextStatsWindow(m.statsWindow)
+				m.refreshDNSStats()
+			}
+		case "t":
+			if m.showDetails && m.selectedDevice != nil {
+				// Cycle the pinned type through every known type, then back to automatic
+				d := m.selectedDevice
+				types := m.scanner.Classifier.Types()
+				next := ""
+				for i, t := range types {
+					if (d.TypeOverride == "" && i == 0) || (i > 0 && types[i-1] == d.TypeOverride) {
+						next = t
+						break
+					}
+				}
+				m.scanner.SetTypeOverride(d.ID, next)
+				d.TypeOverride = next
+				if next != "" {
+					d.DeviceType = next
+				}
+			}
 		case "esc":
 			if m.showDetails {
 				m.showDetails = false
 				m.selectedDevice = nil
 			}
+			m.showStats = false
+			m.showWarnings = false
 		}
 	
 	case tickMsg:
 		// Update Stats
 		if m.dnsServer != nil {
 			m.totalQueries, m.blockedQueries = m.dnsServer.GetStats()
+			m.prefetches, m.prefetchHits = m.dnsServer.GetPrefetchStats()
+			m.dnsState, m.dnsErr = m.dnsServer.State()
+			if m.showStats {
+				m.refreshDNSStats()
+			}
 		}
 		return m, tea.Batch(tickCmd(), scanCmd(m.scanner))
 
 	case scanResultMsg:
 		m.devices = msg
-		m.scanning = false
+		m.warnings = m.scanner.Warnings()
+		m.dhcpServers = m.scanner.DHCPServers()
 		m.updateTable()
 		m.subTitle = fmt.Sprintf("Last updated: %s", time.Now().Format("15:04:05"))
 		return m, nil
@@ -127,6 +189,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}()
 		return m, waitForAlert(m.scanner)
 
+	case progressMsg:
+		m.progress = scanner.Progress(msg)
+		return m, waitForProgress(m.scanner)
+
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -142,6 +208,12 @@ func (m model) View() string {
 	if m.showDetails && m.selectedDevice != nil {
 		return m.viewDetails()
 	}
+	if m.showStats {
+		return m.viewStats()
+	}
+	if m.showWarnings {
+		return m.viewWarnings()
+	}
 
 	title := `
    _____  ______  _   _  _______  _____  _   _  ______  _
@@ -161,8 +233,32 @@ func (m model) View() string {
 	if m.dnsServer != nil {
 		mode = strings.ToUpper(m.dnsServer.Mode)
 	}
-	stats := fmt.Sprintf("\n %s Scanning... | Devices: %d | DNS: %d (%s) | Blocked: %d", 
-		m.spinner.View(), len(m.devices), m.totalQueries, mode, m.blockedQueries)
+	state := m.dnsState
+	switch state {
+	case dns.StateListening:
+		state = onlineStyle.Render(state)
+	case dns.StateFailed:
+		state = errorStyle.Render(state)
+	default:
+		state = offlineStyle.Render(state)
+	}
+	warnings := fmt.Sprint(len(m.warnings))
+	if len(m.warnings) > 0 {
+		warnings = errorStyle.Render(warnings)
+	}
+	activity := "Idle"
+	if m.progress.Scanning && m.progress.Stage != "" {
+		activity = fmt.Sprintf("%s Scanning (%s)", m.spinner.View(), m.progress.Stage)
+	} else if m.progress.Scanning {
+		activity = fmt.Sprintf("%s Scanning %d/%d", m.spinner.View(), m.progress.Probed, m.progress.Total)
+	}
+	stats := fmt.Sprintf("\n %s | Devices: %d | Warnings: %s | DNS: %d (%s, %s) | Blocked: %d | Prefetched: %d (%d hits)", 
+		activity, len(m.devices), warnings, m.totalQueries, mode, state, m.blockedQueries, m.prefetches, m.prefetchHits)
+
+	// DNS failure reason
+	if m.dnsState == dns.StateFailed && m.dnsErr != nil {
+		stats = lipgloss.JoinVertical(lipgloss.Left, stats, errorStyle.Render(" DNS server error: "+m.dnsErr.Error()))
+	}
 	
 	// Alert Banner
 	if m.alert != "" {
@@ -176,7 +272,7 @@ func (m model) View() string {
 	}
 	
 	// Help Line
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\n ↑/↓: Navigate • Enter: Details • q: Quit")
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\n ↑/↓: Navigate • Enter: Details • s: DNS Stats • w: Warnings • r: Scan Now • q: Quit")
 
 	return lipgloss.JoinVertical(lipgloss.Left,
 		header,
@@ -204,37 +300,151 @@ func (m model) viewDetails() string {
 		status = "ONLINE"
 	}
 	
+	seenVia := "N/A"
+	if len(d.Evidence) > 0 {
+		seenVia = strings.Join(d.Evidence, ", ")
+	}
+	rtt := "N/A"
+	if d.RTT > 0 {
+		rtt = d.RTT.Round(10 * time.Microsecond).String()
+	}
+
+	presence := m.scanner.PresenceSummary(d.ID)
+	firstSeen := "N/A"
+	if !d.FirstSeen.IsZero() {
+		firstSeen = d.FirstSeen.Format(time.RFC822)
+	} else if !presence.FirstSeen.IsZero() {
+		firstSeen = presence.FirstSeen.Format(time.RFC822)
+	}
+	uptime := fmt.Sprintf("%.0f%% (24h), %.0f%% (7d)", presence.Uptime24h, presence.Uptime7d)
+
+	hostname := d.Hostname
+	if d.HostnameSource != "" {
+		hostname = fmt.Sprintf("%s (%s)", d.Hostname, d.HostnameSource)
+	}
+	otherNames := "None"
+	var names []string
+	for source, name := range d.Names {
+		if source != d.HostnameSource {
+			names = append(names, fmt.Sprintf("%s (%s)", name, source))
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		otherNames = strings.Join(names, ", ")
+	}
+
+	deviceType := fmt.Sprintf("%s (%d%%)", d.DeviceType, d.TypeConfidence)
+	if d.TypeOverride != "" {
+		deviceType = fmt.Sprintf("%s (set by you)", d.TypeOverride)
+	}
+	typeEvidence := "None"
+	if len(d.TypeEvidence) > 0 {
+		typeEvidence = strings.Join(d.TypeEvidence, "\n                 ")
+	}
+
+	model := strings.TrimSpace(d.ModelName + " " + d.ModelNumber)
+	if model == "" {
+		model = "N/A"
+	}
+	osGuess := "Unknown"
+	if d.OSGuess != "" {
+		osGuess = fmt.Sprintf("%s (%s)", d.OSGuess, d.OSSource)
+	}
+	vendorClass := "N/A"
+	if d.VendorClass != "" {
+		vendorClass = d.VendorClass
+	}
+	tcpStack := "N/A"
+	if d.TCPFingerprint != "" {
+		tcpStack = d.TCPFingerprint
+	}
+	upnp := "None"
+	if len(d.UPnPServices) > 0 {
+		upnp = strings.Join(d.UPnPServices, ", ")
+	}
+
+	ipv6 := "None"
+	if len(d.IPv6) > 0 {
+		var addrs []string
+		for _, addr := range d.IPv6 {
+			addrs = append(addrs, fmt.Sprintf("%s (%s)", addr, scanner.IPv6Scope(addr)))
+		}
+		ipv6 = strings.Join(addrs, "\n                 ")
+	}
+
+	previousIPs := "None"
+	var past []string
+	for _, lease := range d.IPHistory {
+		if lease.IP != d.IP && !contains(past, lease.IP) {
+			past = append(past, lease.IP)
+		}
+	}
+	if len(past) > 0 {
+		previousIPs = strings.Join(past, ", ")
+	}
+
 	ports := "None"
 	if len(d.Ports) > 0 {
-		ports = strings.Join(d.Ports, ", ")
+		ports = renderPorts(d.Ports)
 	}
 
 	content := fmt.Sprintf(`
   Friendly Name: %s
   Hostname:      %s
+  Other Names:   %s
   MAC Address:   %s
+  IPv6:          %s
   Manufacturer:  %s
   Type:          %s
+  Type Evidence: %s
+  Model:         %s
+  OS:            %s
+  DHCP Vendor:   %s
+  TCP Stack:     %s
   Status:        %s
+  Seen Via:      %s
+  Ping RTT:      %s
+  First Seen:    %s
   Last Seen:     %s
+  Uptime:        %s
+  Previous IPs:  %s
+
+  Open Ports:%s
+  mDNS Services:%s
+  UPnP Services: %s
 
-  Open Ports:    %s
-  mDNS Info:     %v
-`,
+  Last 24h:      %s
+%s`,
 		d.FriendlyName,
-		d.Hostname,
+		hostname,
+		otherNames,
 		d.MAC,
+		ipv6,
 		d.Manufacturer,
-		d.DeviceType,
+		deviceType,
+		typeEvidence,
+		model,
+		osGuess,
+		vendorClass,
+		tcpStack,
 		status,
+		seenVia,
+		rtt,
+		firstSeen,
 		d.LastSeen.Format(time.RFC822),
+		uptime,
+		previousIPs,
 		ports,
-		d.MDNSInfo,
+		renderMDNS(d.MDNSServices),
+		upnp,
+		renderTimeline(presence.Last24h),
+		renderSessions(presence.Sessions),
 	)
 	
 	box := baseStyle.Padding(1).Render(content)
 	
-	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\n Esc: Back")
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\n t: Change Type • Esc: Back")
 
 	return lipgloss.JoinVertical(lipgloss.Center,
 		"\n",
@@ -244,6 +454,98 @@ func (m model) viewDetails() string {
 	)
 }
 
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTimeline draws one cell per half hour, oldest on the left.
+func renderTimeline(slots []bool) string {
+	if len(slots) == 0 {
+		return "No history yet"
+	}
+	var b strings.Builder
+	for _, online := range slots {
+		if online {
+			b.WriteString("█")
+		} else {
+			b.WriteString("·")
+		}
+	}
+	return b.String()
+}
+
+// renderSessions lists the most recent online periods.
+func renderSessions(sessions []models.Session) string {
+	var b strings.Builder
+	for i, s := range sessions {
+		if i == 5 {
+			break
+		}
+		end := s.End.Format("Jan 02 15:04")
+		if s.Ongoing {
+			end = "now"
+		}
+		label := ""
+		if i == 0 {
+			label = "Sessions:"
+		}
+		fmt.Fprintf(&b, "  %-14s %s → %s (%s)\n", label, s.Start.Format("Jan 02 15:04"), end, s.Duration().Round(time.Minute))
+	}
+	return b.String()
+}
+
+// renderMDNS lists the advertised services with their TXT records.
+func renderMDNS(services []models.MDNSService) string {
+	if len(services) == 0 {
+		return " None"
+	}
+	var b strings.Builder
+	for _, svc := range services {
+		fmt.Fprintf(&b, "\n    %-22s %s:%d %q", svc.Service, svc.Host, svc.Port, svc.Instance)
+		keys := make([]string, 0, len(svc.TXT))
+		for k := range svc.TXT {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var txt []string
+		for _, k := range keys {
+			txt = append(txt, k+"="+svc.TXT[k])
+		}
+		if len(txt) > 0 {
+			fmt.Fprintf(&b, "\n    %-22s %s", "", strings.Join(txt, " "))
+		}
+	}
+	return b.String()
+}
+
+// renderPorts lists each open port with whatever its banner revealed.
+func renderPorts(ports []models.Port) string {
+	var b strings.Builder
+	for _, p := range ports {
+		fmt.Fprintf(&b, "\n    %-22s %s", p.String(), p.Product)
+		if p.Product == "" && p.Banner != "" {
+			b.WriteString(p.Banner)
+		}
+		if p.Title != "" {
+			fmt.Fprintf(&b, "\n    %-22s title: %s", "", p.Title)
+		}
+		if p.TLS != nil {
+			fmt.Fprintf(&b, "\n    %-22s cert: %s (issuer %s)", "", p.TLS.Subject, p.TLS.Issuer)
+			expiry := "expires " + p.TLS.NotAfter.Format("2006-01-02")
+			if p.TLS.Expired() {
+				expiry = errorStyle.Render("EXPIRED " + p.TLS.NotAfter.Format("2006-01-02"))
+			}
+			fmt.Fprintf(&b, "\n    %-22s %s", "", expiry)
+		}
+	}
+	return b.String()
+}
+
 // Helper commands
 func tickCmd() tea.Cmd {
 	return tea.Tick(time.Second*2, func(t time.Time) tea.Msg {
@@ -262,6 +564,12 @@ func waitForAlert(s *scanner.Scanner) tea.Cmd {
 		return alertMsg(<-s.AlertChan)
 	}
 }
+
+func waitForProgress(s *scanner.Scanner) tea.Cmd {
+	return func() tea.Msg {
+		return progressMsg(<-s.ProgressChan)
+	}
+}
 func (m *model) updateTable() {
 
 	columns := []table.Column{
@@ -338,7 +646,7 @@ func (m *model) updateTable() {
 
 		if len(d.Ports) > 0 {
 
-			info = fmt.Sprintf("%s [%s]", info, d.Ports[0])
+			info = fmt.Sprintf("%s [%s]", info, d.Ports[0].Label())
 
 			if len(d.Ports) > 1 {
 
@@ -367,6 +675,8 @@ func (m *model) updateTable() {
 func main() {
 	wakePtr := flag.String("wake", "", "MAC address to wake (e.g., aa:bb:cc:dd:ee:ff)")
 	configPtr := flag.String("config", "config.json", "Path to configuration file")
+	updateOUIPtr := flag.Bool("update-oui", false, "Download the IEEE MAC vendor registry into oui_dir and exit")
+	dhcpPcapPtr := flag.String("dhcp-pcap", "", "Print the DHCP fingerprints found in a pcap file and exit")
 	flag.Parse()
 
 	// Wake Mode
@@ -380,6 +690,23 @@ func main() {
 		return
 	}
 
+	// DHCP Capture Mode
+	if *dhcpPcapPtr != "" {
+		requests, err := scanner.ReadDHCPCapture(*dhcpPcapPtr)
+		if err != nil {
+			fmt.Printf("Error reading capture: %v\n", err)
+			os.Exit(1)
+		}
+		for _, r := range requests {
+			guess := r.OS
+			if guess == "" {
+				guess = "unknown"
+			}
+			fmt.Printf("%s %-8s %-20s %-10s vendor=%q prl=%s\n", r.MAC, r.MessageType, r.Hostname, guess, r.VendorClass, r.Fingerprint)
+		}
+		return
+	}
+
 	// Load Configuration
 	cfg, err := config.LoadConfig(*configPtr)
 	if err != nil {
@@ -387,6 +714,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// OUI Update Mode
+	if *updateOUIPtr {
+		if err := scanner.DownloadOUI(cfg.OUIDir); err != nil {
+			fmt.Printf("Error updating vendor database: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Vendor database saved to %s\n", cfg.OUIDir)
+		return
+	}
+
 	// Setup Logging
 	logFile, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
@@ -402,16 +739,88 @@ func main() {
 	log.Println("Home Network Sentinel Starting...")
 
 	// TUI Mode
-	// Use configured subnet
-	scanner := scanner.NewScanner(cfg.Subnet, cfg.DevicesFile)
-	scanner.Start(5 * time.Second) // Background scan
+	// Use configured ranges, falling back to the legacy subnet setting
+	ranges := cfg.ScanRanges
+	if len(ranges) == 0 && cfg.Subnet != "" {
+		ranges = []string{cfg.Subnet}
+	}
+	portList, err := scanner.PortProfile(cfg.PortScan.Profile, cfg.PortScan.Profiles)
+	if err != nil {
+		fmt.Printf("Error in port scan configuration: %v\n", err)
+		os.Exit(1)
+	}
+	schedule := scanner.SchedulePolicy{
+		Liveness:      time.Duration(cfg.Schedule.LivenessSeconds) * time.Second,
+		FullSweep:     time.Duration(cfg.Schedule.FullSweepMinutes) * time.Minute,
+		MaxBackoff:    time.Duration(cfg.Schedule.MaxBackoffMinutes) * time.Minute,
+		QuietLiveness: time.Duration(cfg.Schedule.QuietLivenessMinutes) * time.Minute,
+	}
+	schedule.QuietStart, schedule.QuietEnd, err = scanner.ParseQuietHours(cfg.Schedule.QuietHours)
+	if err != nil {
+		fmt.Printf("Error in schedule configuration: %v\n", err)
+		os.Exit(1)
+	}
+	history := scanner.LoadHistory(cfg.HistoryFile, cfg.HistoryDays)
+	vendors, err := scanner.LoadVendorDB(cfg.OUIDir, cfg.OUIOverrides)
+	if err != nil {
+		log.Printf("Vendor database: %v", err)
+	}
+	classifier, err := scanner.LoadClassifier(cfg.DeviceRules)
+	if err != nil {
+		log.Printf("Device rules: %v", err)
+	}
+	scanner, err := scanner.NewScanner(ranges, cfg.ScanExclude, cfg.MaxScanHosts, cfg.DevicesFile)
+	if err != nil {
+		fmt.Printf("Error in scan configuration: %v\n", err)
+		os.Exit(1)
+	}
+	scanner.SetVendors(vendors)
+	scanner.SetClassifier(classifier)
+	scanner.SetHistory(history)
+	scanner.Method = cfg.ScanMethod
+	scanner.ICMP = cfg.Presence.ICMP
+	scanner.Presence.Methods = cfg.Presence.Methods
+	scanner.Presence.MinEvidence = cfg.Presence.MinEvidence
+	scanner.PortList = portList
+	scanner.PortTimeout = time.Duration(cfg.PortScan.TimeoutMS) * time.Millisecond
+	scanner.SetConnectionBudget(cfg.PortScan.MaxConnections)
+	scanner.Banners = cfg.PortScan.Banners
+	scanner.OSFingerprint = cfg.PortScan.OSFingerprint
+	scanner.SSDP = cfg.Discovery.SSDP
+	scanner.DHCPSnoop = cfg.Discovery.DHCPSnoop
+	scanner.IPv6 = cfg.Discovery.IPv6
+	scanner.ARPWatch = cfg.Security.ARPWatch
+	scanner.MaxIPsPerMAC = cfg.Security.MaxIPsPerMAC
+	scanner.DHCPCheck = 0
+	if cfg.Security.DHCPCheck {
+		scanner.DHCPCheck = time.Duration(cfg.Security.DHCPCheckMinutes) * time.Minute
+	}
+	scanner.TrustedDHCP = cfg.Security.TrustedDHCPServers
+	scanner.NameSources = cfg.Discovery.NameSources
+	scanner.Disabled = cfg.Discovery.Disable
+	scanner.Schedule = schedule
+	scanner.Start(context.Background()) // Background scan
 
 	// Start DNS Server
-	dnsServer := dns.NewServer(cfg.UpstreamDNS, cfg.DNSMode, cfg.DoHProvider, cfg.BlockList)
-	go func() {
-		// Uses configured port
-		dnsServer.Start(cfg.DNSPort)
-	}()
+	dnsServer := dns.NewServer(cfg.UpstreamDNS, cfg.DNSMode, cfg.DoHProvider, cfg.BlockList, cfg.UpstreamPrivacy, cfg.Prefetch)
+	if dnsServer.Resolver != nil && len(cfg.RootHints) > 0 {
+		dnsServer.Resolver.RootServers = cfg.RootHints
+	}
+	// Uses configured port. A bind failure is shown in the TUI instead of exiting,
+	// so the scanner stays usable.
+	if err := dnsServer.Start(cfg.DNSPort); err != nil {
+		log.Printf("Failed to start DNS server: %v", err)
+	}
+
+	// Start JSON API (optional)
+	var apiServer *api.Server
+	if cfg.APIAddr != "" {
+		apiServer = api.NewServer(cfg.APIAddr, dnsServer)
+		if err := apiServer.Start(); err != nil {
+			log.Printf("Failed to start API: %v", err)
+			apiServer = nil
+		}
+	}
 
 	// Initialize Table
 	t := table.New(
@@ -437,15 +846,29 @@ func main() {
 	sp.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 
 	m := model{
-		scanner:   scanner,
-		dnsServer: dnsServer,
-		table:     t,
-		spinner:   sp,
-		subTitle:  "Initializing...",
-		alert:     "",
+		scanner:     scanner,
+		dnsServer:   dnsServer,
+		table:       t,
+		spinner:     sp,
+		subTitle:    "Initializing...",
+		alert:       "",
+		statsWindow: "24h",
 	}
+	m.dnsState, m.dnsErr = dnsServer.State()
 
-	if _, err := tea.NewProgram(m).Run(); err != nil {
+	_, err = tea.NewProgram(m).Run()
+
+	// Let in-flight DNS queries finish before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	if shutdownErr := dnsServer.Shutdown(ctx); shutdownErr != nil {
+		log.Printf("DNS shutdown: %v", shutdownErr)
+	}
+	if apiServer != nil {
+		apiServer.Shutdown(ctx)
+	}
+	cancel()
+
+	if err != nil {
 		fmt.Println("Error running program:", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"homenet/internal/dns"
+	"homenet/internal/scanner"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// statsWindowOrder is the order Tab cycles through on the stats screen.
+var statsWindowOrder = []string{"1h", "24h", "7d"}
+
+func nextStatsWindow(current string) string {
+	for i, w := range statsWindowOrder {
+		if w == current {
+			return statsWindowOrder[(i+1)%len(statsWindowOrder)]
+		}
+	}
+	return statsWindowOrder[0]
+}
+
+func (m *model) refreshDNSStats() {
+	if m.dnsServer == nil {
+		return
+	}
+	m.dnsStats = m.dnsServer.Stats.Snapshot(m.statsWindow, 10)
+}
+
+func (m model) viewStats() string {
+	st := m.dnsStats
+
+	title := titleStyle.Render(fmt.Sprintf(" DNS Statistics: last %s ", st.Window))
+	summary := fmt.Sprintf("  Queries: %d   Blocked: %d", st.Queries, st.Blocked)
+	if st.Queries > 0 {
+		summary += fmt.Sprintf(" (%.1f%%)", float64(st.Blocked)*100/float64(st.Queries))
+	}
+
+	domains := lipgloss.JoinHorizontal(lipgloss.Top,
+		baseStyle.Padding(0, 1).Render(renderTop("Top Queried", st.TopDomains, nil)),
+		baseStyle.Padding(0, 1).Render(renderTop("Top Blocked", st.TopBlocked, nil)),
+	)
+	clients := lipgloss.JoinHorizontal(lipgloss.Top,
+		baseStyle.Padding(0, 1).Render(renderTop("Top Clients", st.TopClients, m.clientName)),
+		baseStyle.Padding(0, 1).Render(renderTop("Most Blocked Clients", st.TopBlockedClients, m.clientName)),
+	)
+
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\n Tab: Change window (1h/24h/7d) • Esc: Back")
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		"\n",
+		title,
+		summary,
+		domains,
+		clients,
+		help,
+	)
+}
+
+// clientName labels a client IP with the device name when the scanner knows it.
+func (m model) clientName(ip string) string {
+	for _, d := range m.devices {
+		if d.IP != ip {
+			continue
+		}
+		if d.FriendlyName != "" {
+			return fmt.Sprintf("%s (%s)", d.FriendlyName, ip)
+		}
+		if d.Hostname != "" {
+			return fmt.Sprintf("%s (%s)", d.Hostname, ip)
+		}
+	}
+	return ip
+}
+
+func renderTop(heading string, list []dns.Counter, label func(string) string) string {
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render(heading))
+	b.WriteString("\n")
+	if len(list) == 0 {
+		b.WriteString(offlineStyle.Render("No data yet"))
+		return b.String()
+	}
+	for i, c := range list {
+		key := c.Key
+		if label != nil {
+			key = label(key)
+		}
+		if len(key) > 32 {
+			key = scanner.Truncate(key, 31) + "…"
+		}
+		fmt.Fprintf(&b, "%2d. %-32s %6d\n", i+1, key, c.Count)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
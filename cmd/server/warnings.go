@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"homenet/internal/models"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// warningLabels names each kind of security alert in the warnings pane.
+var warningLabels = map[string]string{
+	models.AlertGatewaySpoof: "Gateway spoofed",
+	models.AlertIPConflict:   "IP conflict",
+	models.AlertMACMultiIP:   "MAC on many IPs",
+	models.AlertRogueDHCP:    "Rogue DHCP",
+}
+
+func (m model) viewWarnings() string {
+	title := titleStyle.Render(fmt.Sprintf(" Security Warnings: %d ", len(m.warnings)))
+
+	var b strings.Builder
+	if len(m.warnings) == 0 {
+		b.WriteString(offlineStyle.Render("No suspicious IP/MAC bindings seen"))
+	}
+	for _, w := range m.warnings {
+		label := warningLabels[w.Kind]
+		if label == "" {
+			label = w.Kind
+		}
+		fmt.Fprintf(&b, "%s  %s %s\n", w.At.Format("Jan 02 15:04"), errorStyle.Render(fmt.Sprintf("%-16s", label)), w.Message)
+	}
+
+	help := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("\n Esc: Back")
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		"\n",
+		title,
+		baseStyle.Padding(0, 1).Render(strings.TrimRight(b.String(), "\n")),
+		baseStyle.Padding(0, 1).Render(renderDHCPServers(m.dhcpServers)),
+		help,
+	)
+}
+
+// renderDHCPServers lists who answered the last rogue DHCP checks.
+func renderDHCPServers(servers []models.DHCPServer) string {
+	var b strings.Builder
+	b.WriteString(lipgloss.NewStyle().Bold(true).Render("DHCP Servers"))
+	if len(servers) == 0 {
+		b.WriteString("\n" + offlineStyle.Render("No offers seen yet"))
+		return b.String()
+	}
+	for _, srv := range servers {
+		trust := onlineStyle.Render("trusted  ")
+		if !srv.Trusted {
+			trust = errorStyle.Render("UNTRUSTED")
+		}
+		fmt.Fprintf(&b, "\n%-15s %s offered %-15s router %-15s DNS %s (%s)",
+			srv.IP, trust, srv.OfferedIP, srv.Router, strings.Join(srv.DNS, ","), srv.LastOffer.Format("15:04"))
+	}
+	return b.String()
+}
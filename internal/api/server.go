@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"homenet/internal/dns"
+)
+
+// Server exposes read-only JSON endpoints for scripts and dashboards.
+type Server struct {
+	dnsServer *dns.Server
+	http      *http.Server
+}
+
+// NewServer creates an API server listening on addr (e.g., "127.0.0.1:8053").
+func NewServer(addr string, dnsServer *dns.Server) *Server {
+	s := &Server{dnsServer: dnsServer}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/dns/stats", s.handleDNSStats)
+
+	s.http = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Start binds the listener and serves requests in the background.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Starting API on %s...", s.http.Addr)
+	go func() {
+		if err := s.http.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("API server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the API server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+// handleDNSStats serves GET /api/dns/stats?window=24h&limit=10
+func (s *Server) handleDNSStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "24h"
+	}
+	if _, ok := dns.StatsWindows[window]; !ok {
+		http.Error(w, "window must be one of 1h, 24h, 7d", http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, s.dnsServer.Stats.Snapshot(window, limit))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("API: encoding response: %v", err)
+	}
+}
@@ -7,14 +7,95 @@ import (
 
 // Config holds the application configuration.
 type Config struct {
-	Subnet       string   `json:"subnet"`             // e.g., "192.168.1" or empty for auto
+	Subnet       string   `json:"subnet"`             // Legacy single /24, e.g., "192.168.1"; use scan_ranges instead
+	ScanRanges   []string `json:"scan_ranges"`        // CIDRs to sweep, e.g., ["192.168.0.0/22"]; empty for auto
+	ScanExclude  []string `json:"scan_exclude"`       // CIDRs or addresses never probed
+	MaxScanHosts int      `json:"max_scan_hosts"`     // Largest range accepted (addresses); 0 for 4096
+	ScanMethod   string   `json:"scan_method"`        // "arp" (falls back to TCP without raw sockets) or "tcp"
 	UpstreamDNS  string   `json:"upstream_dns"`       // e.g., "1.1.1.1:53"
-	DNSMode      string   `json:"dns_mode"`           // "udp", "doh", "dot"
+	DNSMode      string   `json:"dns_mode"`           // "udp", "doh", "dot", "recursive"
 	DoHProvider  string   `json:"doh_provider"`       // e.g., "https://cloudflare-dns.com/dns-query"
 	DNSPort      string   `json:"dns_port"`           // e.g., "53"
 	BlockList    []string `json:"block_list"`         // List of domains to block
 	LogFile      string   `json:"log_file"`           // Path to log file
 	DevicesFile  string   `json:"devices_file"`       // Path to devices.json
+	HistoryFile  string   `json:"history_file"`       // Path to the online/offline history
+	HistoryDays  int      `json:"history_days"`       // How long transitions are kept
+	RootHints    []string `json:"root_hints"`         // Root servers for recursive mode, empty for IANA roots
+	APIAddr      string   `json:"api_addr"`           // e.g., "127.0.0.1:8053", empty disables the JSON API
+	OUIDir       string   `json:"oui_dir"`            // Directory holding the IEEE oui.csv, mam.csv and oui36.csv (fetched by -update-oui, not bundled)
+	OUIOverrides string   `json:"oui_overrides"`      // JSON file of custom MAC prefixes, e.g. {"AA:BB:CC": "Lab switch"}
+	DeviceRules  string   `json:"device_rules"`       // JSON file of extra device type rules
+
+	Presence        PresenceConfig  `json:"presence"`         // Which probes decide that a device is online
+	PortScan        PortScanConfig  `json:"port_scan"`        // Which TCP ports are probed and how hard
+	Discovery       DiscoveryConfig `json:"discovery"`        // Protocols used to learn names and models
+	Security        SecurityConfig  `json:"security"`         // Detection of ARP spoofing and MAC conflicts
+	Schedule        ScheduleConfig  `json:"schedule"`         // How often devices are checked and the network swept
+	UpstreamPrivacy PrivacyConfig   `json:"upstream_privacy"` // What forwarded queries reveal upstream
+	Prefetch        PrefetchConfig  `json:"prefetch"`         // Background refresh of popular cache entries
+}
+
+// PrivacyConfig controls how much forwarded DNS queries reveal about the network.
+type PrivacyConfig struct {
+	ECSMode         string   `json:"ecs_mode"`           // "strip", "fixed" or "passthrough"
+	ECSSubnet       string   `json:"ecs_subnet"`         // e.g., "192.0.2.0/24", used when ecs_mode is "fixed"
+	Padding         bool     `json:"padding"`            // EDNS0 padding on doh/dot (RFC 7830/8467)
+	QNAMEMinimise   bool     `json:"qname_minimisation"` // Send only the needed labels when resolving recursively
+	RotateUpstreams bool     `json:"rotate_upstreams"`   // Pick a random upstream per query
+	Upstreams       []string `json:"upstreams"`          // Extra upstreams for rotation (same transport as dns_mode)
+}
+
+// PresenceConfig controls how probe results are combined into online/offline.
+type PresenceConfig struct {
+	ICMP        bool     `json:"icmp"`         // Send ICMP echo requests to every target
+	Methods     []string `json:"methods"`      // Probes counted as evidence: "arp", "icmp", "tcp"
+	MinEvidence int      `json:"min_evidence"` // How many of those must answer
+}
+
+// DiscoveryConfig enables the protocols devices use to announce themselves.
+type DiscoveryConfig struct {
+	SSDP        bool     `json:"ssdp"`         // UPnP M-SEARCH and description XML
+	DHCPSnoop   bool     `json:"dhcp_snoop"`   // Listen for DHCP requests on UDP 67 (needs root)
+	IPv6        bool     `json:"ipv6"`         // Multicast ping ff02::1 and read the IPv6 neighbor table
+	NameSources []string `json:"name_sources"` // Hostname sources by priority: "dns", "dhcp", "mdns", "netbios", "llmnr"
+	Disable     []string `json:"disable"`      // Probes to skip: "arp", "icmp", "tcp", "arp_table", "ipv6", "mdns", "ssdp"
+}
+
+// SecurityConfig controls which network anomalies raise alerts.
+type SecurityConfig struct {
+	ARPWatch           bool     `json:"arp_watch"`            // Alert on gateway MAC changes, IPs flipping between MACs and MACs claiming many IPs
+	MaxIPsPerMAC       int      `json:"max_ips_per_mac"`      // More addresses than this behind one MAC is an alert
+	DHCPCheck          bool     `json:"dhcp_check"`           // Periodically broadcast a DHCPDISCOVER to find rogue servers (needs root)
+	DHCPCheckMinutes   int      `json:"dhcp_check_minutes"`   // How often the check runs
+	TrustedDHCPServers []string `json:"trusted_dhcp_servers"` // IPs or MACs allowed to offer leases; empty trusts the default gateway
+}
+
+// ScheduleConfig decides how often the network is probed.
+type ScheduleConfig struct {
+	LivenessSeconds      int    `json:"liveness_seconds"`       // How often known devices are checked (ARP, ping and their open ports)
+	FullSweepMinutes     int    `json:"full_sweep_minutes"`     // How often every address is probed with every method to find new devices
+	MaxBackoffMinutes    int    `json:"max_backoff_minutes"`    // Longest gap between checks of a device that has been offline a long time
+	QuietHours           string `json:"quiet_hours"`            // Local time window without full sweeps, e.g. "23:00-07:00"; empty for none
+	QuietLivenessMinutes int    `json:"quiet_liveness_minutes"` // How often known devices are checked during quiet hours
+}
+
+// PortScanConfig selects the TCP ports probed on every host.
+type PortScanConfig struct {
+	Profile        string              `json:"profile"`         // "quick", "common-1000" or a key of profiles
+	Profiles       map[string][]string `json:"profiles"`        // Custom port lists, e.g. {"iot": ["80", "1883", "8000-8100"]}
+	TimeoutMS      int                 `json:"timeout_ms"`      // Per-connection timeout
+	MaxConnections int                 `json:"max_connections"` // Simultaneous connection attempts across all hosts
+	Banners        bool                `json:"banners"`         // Read SSH/FTP/SMTP greetings, HTTP headers and TLS certificates
+	OSFingerprint  bool                `json:"os_fingerprint"`  // Guess the OS from SYN-ACK TTL, window and options (needs root)
+}
+
+// PrefetchConfig controls refreshing popular cached answers shortly before they expire.
+type PrefetchConfig struct {
+	Enabled          bool `json:"enabled"`
+	MinHits          int  `json:"min_hits"`          // Hits within one TTL before an entry counts as popular
+	ThresholdPercent int  `json:"threshold_percent"` // Refresh once less than this much of the TTL remains
+	MaxConcurrent    int  `json:"max_concurrent"`    // Upper bound on prefetches in flight
 }
 
 // DefaultConfig returns a configuration with sensible defaults.
@@ -47,6 +128,50 @@ func DefaultConfig() *Config {
 		},
 		LogFile:     "homenet.log",
 		DevicesFile: "devices.json",
+		HistoryFile: "history.json",
+		HistoryDays: 30,
+		OUIDir:       "oui",
+		OUIOverrides: "oui_overrides.json",
+		DeviceRules:  "device_rules.json",
+		ScanMethod:  "arp",
+		Presence: PresenceConfig{
+			ICMP:        true,
+			Methods:     []string{"arp", "icmp", "tcp"},
+			MinEvidence: 1,
+		},
+		PortScan: PortScanConfig{
+			Profile:        "quick",
+			TimeoutMS:      300,
+			MaxConnections: 256,
+			Banners:        true,
+			OSFingerprint:  true,
+		},
+		Discovery: DiscoveryConfig{
+			SSDP:        true,
+			IPv6:        true,
+			NameSources: []string{"dns", "dhcp", "mdns", "netbios", "llmnr"},
+		},
+		Security: SecurityConfig{
+			ARPWatch:         true,
+			MaxIPsPerMAC:     4,
+			DHCPCheckMinutes: 15,
+		},
+		Schedule: ScheduleConfig{
+			LivenessSeconds:      30,
+			FullSweepMinutes:     10,
+			MaxBackoffMinutes:    60,
+			QuietLivenessMinutes: 5,
+		},
+		UpstreamPrivacy: PrivacyConfig{
+			ECSMode: "strip",
+			Padding: true,
+		},
+		Prefetch: PrefetchConfig{
+			Enabled:          true,
+			MinHits:          3,
+			ThresholdPercent: 10,
+			MaxConcurrent:    4,
+		},
 	}
 }
 
@@ -65,8 +190,9 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	// Parse JSON
-	var cfg Config
+	// Parse JSON over the defaults, so options missing from older files
+	// (notably the ones that default to on) keep their default
+	cfg := *DefaultConfig()
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err
 	}
@@ -78,6 +204,28 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.DNSPort == "" { cfg.DNSPort = "53" }
 	if cfg.LogFile == "" { cfg.LogFile = "homenet.log" }
 	if cfg.DevicesFile == "" { cfg.DevicesFile = "devices.json" }
+	if cfg.HistoryFile == "" { cfg.HistoryFile = "history.json" }
+	if cfg.HistoryDays <= 0 { cfg.HistoryDays = 30 }
+	if cfg.OUIDir == "" { cfg.OUIDir = "oui" }
+	if cfg.OUIOverrides == "" { cfg.OUIOverrides = "oui_overrides.json" }
+	if cfg.DeviceRules == "" { cfg.DeviceRules = "device_rules.json" }
+	if cfg.ScanMethod == "" { cfg.ScanMethod = "arp" }
+	if len(cfg.Presence.Methods) == 0 { cfg.Presence.Methods = []string{"arp", "icmp", "tcp"} }
+	if cfg.Presence.MinEvidence <= 0 { cfg.Presence.MinEvidence = 1 }
+	if cfg.PortScan.Profile == "" { cfg.PortScan.Profile = "quick" }
+	if cfg.PortScan.TimeoutMS <= 0 { cfg.PortScan.TimeoutMS = 300 }
+	if cfg.PortScan.MaxConnections <= 0 { cfg.PortScan.MaxConnections = 256 }
+	if cfg.Security.MaxIPsPerMAC <= 0 { cfg.Security.MaxIPsPerMAC = 4 }
+	if cfg.Security.DHCPCheckMinutes <= 0 { cfg.Security.DHCPCheckMinutes = 15 }
+	if cfg.Schedule.LivenessSeconds <= 0 { cfg.Schedule.LivenessSeconds = 30 }
+	if cfg.Schedule.FullSweepMinutes <= 0 { cfg.Schedule.FullSweepMinutes = 10 }
+	if cfg.Schedule.MaxBackoffMinutes <= 0 { cfg.Schedule.MaxBackoffMinutes = 60 }
+	if cfg.Schedule.QuietLivenessMinutes <= 0 { cfg.Schedule.QuietLivenessMinutes = 5 }
+	if len(cfg.Discovery.NameSources) == 0 { cfg.Discovery.NameSources = []string{"dns", "dhcp", "mdns", "netbios", "llmnr"} }
+	if cfg.UpstreamPrivacy.ECSMode == "" { cfg.UpstreamPrivacy.ECSMode = "strip" }
+	if cfg.Prefetch.MinHits <= 0 { cfg.Prefetch.MinHits = 3 }
+	if cfg.Prefetch.ThresholdPercent <= 0 { cfg.Prefetch.ThresholdPercent = 10 }
+	if cfg.Prefetch.MaxConcurrent <= 0 { cfg.Prefetch.MaxConcurrent = 4 }
 
 	return &cfg, nil
 }
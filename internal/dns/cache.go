@@ -0,0 +1,272 @@
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	maxCacheTTL        = 24 * time.Hour
+	defaultNegativeTTL = 60 * time.Second
+	defaultCacheSize   = 10000
+)
+
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type cacheEntry struct {
+	msg         *dns.Msg
+	stored      time.Time
+	expires     time.Time
+	hits        uint64
+	prefetched  bool // Stored by a background prefetch rather than a client miss
+	prefetching bool // A refresh is already in flight
+}
+
+type delegation struct {
+	servers []string
+	expires time.Time
+}
+
+// Cache stores DNS answers and known zone delegations until their TTL runs out.
+type Cache struct {
+	mu          sync.Mutex
+	entries     map[cacheKey]*cacheEntry
+	delegations map[string]*delegation
+	maxEntries  int
+
+	// Prefetch policy: entries hit at least PrefetchMinHits times are refreshed
+	// once less than PrefetchThreshold of their TTL remains. Zero disables it.
+	PrefetchMinHits   uint64
+	PrefetchThreshold float64
+
+	Hits         uint64
+	Misses       uint64
+	PrefetchHits uint64 // Hits served by an entry a prefetch refreshed
+}
+
+// NewCache creates a cache holding at most maxEntries answers.
+func NewCache(maxEntries int) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheSize
+	}
+	return &Cache{
+		entries:     make(map[cacheKey]*cacheEntry),
+		delegations: make(map[string]*delegation),
+		maxEntries:  maxEntries,
+	}
+}
+
+// Get returns a copy of a cached answer with TTLs reduced by the time it has been stored.
+func (c *Cache) Get(name string, qtype uint16) (*dns.Msg, bool) {
+	msg, _, ok := c.Lookup(name, qtype)
+	return msg, ok
+}
+
+// Lookup is like Get but also reports whether the caller should refresh the entry
+// in the background. It reports true at most once per stored answer.
+func (c *Cache) Lookup(name string, qtype uint16) (*dns.Msg, bool, bool) {
+	key := cacheKey{strings.ToLower(name), qtype}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	now := time.Now()
+	if ok && now.After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.Misses++
+		return nil, false, false
+	}
+
+	c.Hits++
+	entry.hits++
+	if entry.prefetched {
+		c.PrefetchHits++
+	}
+
+	refresh := false
+	if c.PrefetchMinHits > 0 && !entry.prefetching && entry.hits >= c.PrefetchMinHits {
+		total := entry.expires.Sub(entry.stored)
+		if float64(entry.expires.Sub(now)) < float64(total)*c.PrefetchThreshold {
+			entry.prefetching = true
+			refresh = true
+		}
+	}
+
+	msg := entry.msg.Copy()
+	elapsed := uint32(now.Sub(entry.stored).Seconds())
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+	return msg, refresh, true
+}
+
+// ReleasePrefetch lets a later Lookup trigger a refresh again, e.g. after a prefetch was skipped.
+func (c *Cache) ReleasePrefetch(name string, qtype uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[cacheKey{strings.ToLower(name), qtype}]; ok {
+		entry.prefetching = false
+	}
+}
+
+// Stats returns hit, miss and prefetch hit counters.
+func (c *Cache) Stats() (uint64, uint64, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Hits, c.Misses, c.PrefetchHits
+}
+
+// Set stores an answer. Server failures and zero-TTL answers are not cached.
+func (c *Cache) Set(name string, qtype uint16, msg *dns.Msg) {
+	c.set(name, qtype, msg, false)
+}
+
+// SetPrefetched stores an answer fetched by a background prefetch. The entry
+// keeps its hit count, so a popular name stays eligible for the next prefetch.
+func (c *Cache) SetPrefetched(name string, qtype uint16, msg *dns.Msg) {
+	c.set(name, qtype, msg, true)
+}
+
+func (c *Cache) set(name string, qtype uint16, msg *dns.Msg, prefetched bool) {
+	ttl := cacheTTL(msg)
+	if ttl <= 0 {
+		return
+	}
+	key := cacheKey{strings.ToLower(name), qtype}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old, exists := c.entries[key]
+	if !exists && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	entry := &cacheEntry{
+		msg:        msg.Copy(),
+		stored:     now,
+		expires:    now.Add(ttl),
+		prefetched: prefetched,
+	}
+	if exists && prefetched {
+		entry.hits = old.hits
+	}
+	c.entries[key] = entry
+}
+
+// evict drops expired entries, or an arbitrary one if nothing has expired.
+// Callers must hold c.mu.
+func (c *Cache) evict(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
+
+// SetDelegation remembers the name server addresses for a zone.
+func (c *Cache) SetDelegation(zone string, servers []string, ttl time.Duration) {
+	if ttl <= 0 || len(servers) == 0 {
+		return
+	}
+	if ttl > maxCacheTTL {
+		ttl = maxCacheTTL
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delegations[strings.ToLower(zone)] = &delegation{
+		servers: servers,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// Delegation returns the closest known enclosing zone of name and its servers.
+func (c *Cache) Delegation(name string) (string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	zone := strings.ToLower(name)
+	for {
+		if d, ok := c.delegations[zone]; ok {
+			if now.Before(d.expires) {
+				return zone, d.servers
+			}
+			delete(c.delegations, zone)
+		}
+		if zone == "." {
+			return "", nil
+		}
+		off, end := dns.NextLabel(zone, 0)
+		if end {
+			zone = "."
+		} else {
+			zone = zone[off:]
+		}
+	}
+}
+
+// cacheTTL works out how long a response may be cached.
+// Negative answers use the SOA minimum as described in RFC 2308.
+func cacheTTL(msg *dns.Msg) time.Duration {
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return 0
+	}
+
+	if len(msg.Answer) > 0 && msg.Rcode == dns.RcodeSuccess {
+		ttl := minTTL(msg.Answer)
+		return capTTL(time.Duration(ttl) * time.Second)
+	}
+
+	for _, rr := range msg.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			ttl := soa.Hdr.Ttl
+			if soa.Minttl < ttl {
+				ttl = soa.Minttl
+			}
+			return capTTL(time.Duration(ttl) * time.Second)
+		}
+	}
+	return defaultNegativeTTL
+}
+
+func minTTL(rrs []dns.RR) uint32 {
+	var ttl uint32
+	for i, rr := range rrs {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return ttl
+}
+
+func capTTL(ttl time.Duration) time.Duration {
+	if ttl > maxCacheTTL {
+		return maxCacheTTL
+	}
+	return ttl
+}
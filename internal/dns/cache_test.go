@@ -0,0 +1,34 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSetPrefetchedKeepsHits(t *testing.T) {
+	c := NewCache(10)
+	c.PrefetchMinHits = 3
+	c.PrefetchThreshold = 1 // Any remaining TTL is below the threshold
+
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+	msg.Answer = []dns.RR{rr(t, "example.com. 300 IN A 192.0.2.1")}
+	c.Set("example.com.", dns.TypeA, msg)
+
+	for i := 0; i < 3; i++ {
+		c.Lookup("example.com.", dns.TypeA)
+	}
+	c.SetPrefetched("example.com.", dns.TypeA, msg)
+
+	// The refreshed entry is still popular, so the next hit prefetches again
+	if _, refresh, ok := c.Lookup("example.com.", dns.TypeA); !ok || !refresh {
+		t.Errorf("lookup after prefetch: found %v, refresh %v; want a refresh", ok, refresh)
+	}
+
+	// A client miss starts counting afresh
+	c.Set("example.com.", dns.TypeA, msg)
+	if _, refresh, _ := c.Lookup("example.com.", dns.TypeA); refresh {
+		t.Error("refresh requested for a newly stored entry")
+	}
+}
@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"log"
+
+	"github.com/miekg/dns"
+)
+
+// prefetch refreshes a popular cache entry in the background before it expires.
+// If too many prefetches are already running the refresh is skipped and may be
+// retried on the next hit.
+func (s *Server) prefetch(r *dns.Msg) {
+	q := r.Question[0]
+
+	select {
+	case s.prefetchSem <- struct{}{}:
+	default:
+		s.Cache.ReleasePrefetch(q.Name, q.Qtype)
+		return
+	}
+
+	go func() {
+		defer func() { <-s.prefetchSem }()
+
+		resp, err := s.fetch(r)
+		if err != nil {
+			log.Printf("[PREFETCH] Failed to refresh %s: %v\n", q.Name, err)
+			s.Cache.ReleasePrefetch(q.Name, q.Qtype)
+			return
+		}
+		s.Cache.SetPrefetched(q.Name, q.Qtype, resp)
+
+		s.mu.Lock()
+		s.Prefetches++
+		s.mu.Unlock()
+	}()
+}
+
+// GetPrefetchStats returns the number of completed prefetches and the cache hits they served.
+func (s *Server) GetPrefetchStats() (uint64, uint64) {
+	s.mu.RLock()
+	prefetches := s.Prefetches
+	s.mu.RUnlock()
+
+	_, _, hits := s.Cache.Stats()
+	return prefetches, hits
+}
@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"math/rand"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// paddingBlock is the recommended query block size from RFC 8467.
+const paddingBlock = 128
+
+// prepareUpstream builds the query we actually send upstream from a client request.
+// It applies the configured ECS policy and pads the message for encrypted transports.
+func (s *Server) prepareUpstream(r *dns.Msg) *dns.Msg {
+	q := r.Copy()
+	q.Response = false
+	q.RecursionDesired = true
+
+	opt := q.IsEdns0()
+	switch s.Privacy.ECSMode {
+	case "passthrough":
+		// Leave whatever the client sent
+	case "fixed":
+		if opt == nil {
+			opt = setEdns0(q)
+		}
+		stripOption(opt, dns.EDNS0SUBNET)
+		if ecs := fixedECS(s.Privacy.ECSSubnet); ecs != nil {
+			opt.Option = append(opt.Option, ecs)
+		}
+	default:
+		// "strip": never reveal client subnets to the upstream
+		if opt != nil {
+			stripOption(opt, dns.EDNS0SUBNET)
+		}
+	}
+
+	if s.Privacy.Padding && (s.Mode == "doh" || s.Mode == "dot") {
+		if opt == nil {
+			opt = setEdns0(q)
+		}
+		padMessage(q, opt)
+	}
+
+	return q
+}
+
+// upstreams returns the list of servers to try for the current mode, in order.
+func (s *Server) upstreams() []string {
+	primary := s.Upstream
+	if s.Mode == "doh" {
+		primary = s.DoHProvider
+	}
+	list := append([]string{primary}, s.Privacy.Upstreams...)
+
+	if s.Privacy.RotateUpstreams && len(list) > 1 {
+		rand.Shuffle(len(list), func(i, j int) {
+			list[i], list[j] = list[j], list[i]
+		})
+	}
+	return list
+}
+
+func setEdns0(m *dns.Msg) *dns.OPT {
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	return m.IsEdns0()
+}
+
+func stripOption(opt *dns.OPT, code uint16) {
+	kept := opt.Option[:0]
+	for _, o := range opt.Option {
+		if o.Option() != code {
+			kept = append(kept, o)
+		}
+	}
+	opt.Option = kept
+}
+
+// fixedECS turns a CIDR like "192.0.2.0/24" into an ECS option.
+// An empty or invalid subnet yields a zero-length source prefix, which asks
+// the upstream not to use client location at all (RFC 7871 section 7.1.2).
+func fixedECS(subnet string) *dns.EDNS0_SUBNET {
+	ecs := &dns.EDNS0_SUBNET{
+		Code:    dns.EDNS0SUBNET,
+		Family:  1,
+		Address: net.IPv4zero.To4(),
+	}
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return ecs
+	}
+	ones, _ := ipnet.Mask.Size()
+	ecs.SourceNetmask = uint8(ones)
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		ecs.Address = ip4
+	} else {
+		ecs.Family = 2
+		ecs.Address = ipnet.IP
+	}
+	return ecs
+}
+
+// padMessage adds an EDNS0 padding option so the packed query is a multiple of paddingBlock.
+func padMessage(m *dns.Msg, opt *dns.OPT) {
+	stripOption(opt, dns.EDNS0PADDING)
+	// Option header (code + length) is 4 bytes
+	size := m.Len() + 4
+	padLen := (paddingBlock - size%paddingBlock) % paddingBlock
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, padLen)})
+}
@@ -0,0 +1,140 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"homenet/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+// clientQuery returns a query for name, carrying ECS for subnet if set.
+func clientQuery(name, subnet string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, dns.TypeA)
+	m.RecursionDesired = false
+	if subnet != "" {
+		opt := setEdns0(m)
+		opt.Option = append(opt.Option, fixedECS(subnet))
+	}
+	return m
+}
+
+// ecsOf returns the ECS option of m as "address/prefix", or "" if it has none.
+func ecsOf(m *dns.Msg) string {
+	opt := m.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+			return (&net.IPNet{IP: ecs.Address, Mask: net.CIDRMask(int(ecs.SourceNetmask), 8*len(ecs.Address))}).String()
+		}
+	}
+	return ""
+}
+
+func TestPrepareUpstreamECS(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		subnet   string // Configured for "fixed"
+		clientIn string // ECS the client sent
+		want     string
+	}{
+		{name: "strip default", clientIn: "198.51.100.0/24", want: ""},
+		{name: "strip", mode: "strip", clientIn: "198.51.100.0/24", want: ""},
+		{name: "strip without ECS", mode: "strip", want: ""},
+		{name: "passthrough", mode: "passthrough", clientIn: "198.51.100.0/24", want: "198.51.100.0/24"},
+		{name: "fixed replaces", mode: "fixed", subnet: "192.0.2.0/24", clientIn: "198.51.100.0/24", want: "192.0.2.0/24"},
+		{name: "fixed adds", mode: "fixed", subnet: "192.0.2.0/24", want: "192.0.2.0/24"},
+		{name: "fixed invalid", mode: "fixed", subnet: "nonsense", clientIn: "198.51.100.0/24", want: "0.0.0.0/0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Server{Mode: "udp", Privacy: config.PrivacyConfig{ECSMode: tc.mode, ECSSubnet: tc.subnet}}
+			r := clientQuery("example.com.", tc.clientIn)
+
+			q := s.prepareUpstream(r)
+			if got := ecsOf(q); got != tc.want {
+				t.Errorf("upstream ECS = %q, want %q", got, tc.want)
+			}
+			if !q.RecursionDesired || q.Response {
+				t.Error("upstream query is not a recursive question")
+			}
+			// The client's message is left alone
+			if got := ecsOf(r); got != tc.clientIn {
+				t.Errorf("client ECS changed to %q", got)
+			}
+		})
+	}
+}
+
+func TestPrepareUpstreamPadding(t *testing.T) {
+	for _, tc := range []struct {
+		mode    string
+		padding bool
+		want    bool
+	}{
+		{"dot", true, true},
+		{"doh", true, true},
+		{"udp", true, false},
+		{"dot", false, false},
+	} {
+		s := &Server{Mode: tc.mode, Privacy: config.PrivacyConfig{Padding: tc.padding}}
+		q := s.prepareUpstream(clientQuery("example.com.", ""))
+
+		padded := false
+		if opt := q.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				padded = padded || o.Option() == dns.EDNS0PADDING
+			}
+		}
+		if padded != tc.want {
+			t.Errorf("mode %s, padding %v: padded = %v, want %v", tc.mode, tc.padding, padded, tc.want)
+		}
+	}
+}
+
+func TestPadMessageBlockSize(t *testing.T) {
+	for _, n := range []int{1, 10, 50, 60, 63, 100, 200} {
+		labels := make([]string, 0, 4)
+		for rest := n; rest > 0; rest -= 63 {
+			labels = append(labels, strings.Repeat("a", min(rest, 63)))
+		}
+		m := clientQuery(strings.Join(labels, ".")+".example.", "")
+		opt := setEdns0(m)
+
+		padMessage(m, opt)
+		packed, err := m.Pack()
+		if err != nil {
+			t.Fatalf("name of %d bytes: %v", n, err)
+		}
+		if len(packed)%paddingBlock != 0 {
+			t.Errorf("name of %d bytes: padded query is %d bytes, not a multiple of %d", n, len(packed), paddingBlock)
+		}
+
+		// Padding again replaces the old option instead of adding another
+		padMessage(m, opt)
+		if again, _ := m.Pack(); len(again) != len(packed) {
+			t.Errorf("name of %d bytes: re-padded to %d bytes, want %d", n, len(again), len(packed))
+		}
+	}
+}
+
+func TestDoTAddr(t *testing.T) {
+	for in, want := range map[string]string{
+		"1.1.1.1:53":           "1.1.1.1:853",
+		"1.1.1.1":              "1.1.1.1:853",
+		"1.1.1.1:853":          "1.1.1.1:853",
+		"9.9.9.9:8853":         "9.9.9.9:8853",
+		"dns.example:53":       "dns.example:853",
+		"[2606:4700::1111]:53": "[2606:4700::1111]:853",
+		"2606:4700::1111":      "[2606:4700::1111]:853",
+	} {
+		if got := dotAddr(in); got != want {
+			t.Errorf("dotAddr(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
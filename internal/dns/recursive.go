@@ -0,0 +1,381 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultRootServers are the IPv4 root hints from https://www.internic.net/domain/named.root
+var defaultRootServers = []string{
+	"198.41.0.4:53",     // a.root-servers.net
+	"170.247.170.2:53",  // b.root-servers.net
+	"192.33.4.12:53",    // c.root-servers.net
+	"199.7.91.13:53",    // d.root-servers.net
+	"192.203.230.10:53", // e.root-servers.net
+	"192.5.5.241:53",    // f.root-servers.net
+	"192.112.36.4:53",   // g.root-servers.net
+	"198.97.190.53:53",  // h.root-servers.net
+	"192.36.148.17:53",  // i.root-servers.net
+	"192.58.128.30:53",  // j.root-servers.net
+	"193.0.14.129:53",   // k.root-servers.net
+	"199.7.83.42:53",    // l.root-servers.net
+	"202.12.27.33:53",   // m.root-servers.net
+}
+
+const (
+	maxReferrals  = 30 // Delegations followed for a single name
+	maxCNAMEChain = 10 // CNAMEs chased before giving up
+	maxDepth      = 8  // Nested lookups, e.g. for name servers without glue
+)
+
+var (
+	errResolveTimeout = errors.New("recursive resolution timed out")
+	errNoServers      = errors.New("no reachable name servers")
+)
+
+// Resolver resolves names iteratively starting from the root servers,
+// so no third-party upstream ever sees the full query stream.
+type Resolver struct {
+	RootServers    []string // "ip:port"; the IANA roots unless overridden
+	QueryTimeout   time.Duration
+	ResolveTimeout time.Duration
+	QNAMEMinimise  bool // RFC 9156: only send the labels each server needs
+	Cache          *Cache
+	port           string // Port name servers are queried on; "53" unless testing
+}
+
+// NewResolver creates a recursive resolver. Empty rootServers uses the IANA root hints.
+func NewResolver(rootServers []string, qnameMinimise bool) *Resolver {
+	if len(rootServers) == 0 {
+		rootServers = defaultRootServers
+	}
+	return &Resolver{
+		RootServers:    rootServers,
+		QueryTimeout:   2 * time.Second,
+		ResolveTimeout: 10 * time.Second,
+		QNAMEMinimise:  qnameMinimise,
+		Cache:          NewCache(defaultCacheSize),
+	}
+}
+
+// Resolve looks up name/qtype and returns a response with the answer and authority sections filled.
+func (r *Resolver) Resolve(name string, qtype uint16) (*dns.Msg, error) {
+	deadline := time.Now().Add(r.ResolveTimeout)
+	return r.resolve(strings.ToLower(dns.Fqdn(name)), qtype, 0, deadline)
+}
+
+// Refresh resolves name/qtype from the authoritative servers even if it is cached.
+// Storing the new answer is left to the caller.
+func (r *Resolver) Refresh(name string, qtype uint16) (*dns.Msg, error) {
+	deadline := time.Now().Add(r.ResolveTimeout)
+	return r.fetch(strings.ToLower(dns.Fqdn(name)), qtype, 0, deadline)
+}
+
+func (r *Resolver) resolve(name string, qtype uint16, depth int, deadline time.Time) (*dns.Msg, error) {
+	if msg, ok := r.Cache.Get(name, qtype); ok {
+		return msg, nil
+	}
+	msg, err := r.fetch(name, qtype, depth, deadline)
+	if err != nil {
+		return nil, err
+	}
+	r.Cache.Set(name, qtype, msg)
+	return msg, nil
+}
+
+func (r *Resolver) fetch(name string, qtype uint16, depth int, deadline time.Time) (*dns.Msg, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("resolving %s: too many nested lookups", name)
+	}
+
+	resp, err := r.iterate(name, qtype, depth, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.Rcode = resp.Rcode
+	msg.Answer = resp.Answer
+	msg.Ns = resp.Ns
+
+	if qtype != dns.TypeCNAME {
+		if err := r.chaseCNAME(msg, qtype, depth, deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// iterate walks down the delegation tree from the closest known zone to the authoritative servers.
+func (r *Resolver) iterate(name string, qtype uint16, depth int, deadline time.Time) (*dns.Msg, error) {
+	zone, servers := r.Cache.Delegation(name)
+	if servers == nil {
+		zone, servers = ".", r.RootServers
+	}
+
+	// known is the longest name we have already asked about while minimising
+	known := zone
+	minimise := r.QNAMEMinimise
+	labels := dns.CountLabel(name)
+
+	for i := 0; i < maxReferrals; i++ {
+		if time.Now().After(deadline) {
+			return nil, errResolveTimeout
+		}
+
+		qname, qt := name, qtype
+		if minimise {
+			if n := dns.CountLabel(known) + 1; n < labels {
+				qname, qt = lastLabels(name, n), dns.TypeNS
+			}
+		}
+
+		resp, err := r.query(servers, qname, qt, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		if child, nsNames := referral(resp, zone); child != "" {
+			next, err := r.serversFor(child, nsNames, resp, zone, depth, deadline)
+			if err != nil {
+				return nil, err
+			}
+			zone, servers = child, next
+			if dns.CountLabel(child) > dns.CountLabel(known) {
+				known = child
+			}
+			continue
+		}
+
+		if qname != name {
+			// A minimised step without a delegation
+			switch {
+			case resp.Rcode == dns.RcodeNameError:
+				// Nothing exists below a non-existent name (RFC 8020)
+				return resp, nil
+			case hasType(resp.Answer, dns.TypeCNAME):
+				// The intermediate name is an alias; ask for the full name instead
+				minimise = false
+			default:
+				// Same servers are authoritative for the next label too
+				known = qname
+			}
+			continue
+		}
+
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			return nil, fmt.Errorf("resolving %s: %s", name, dns.RcodeToString[resp.Rcode])
+		}
+		// Answer, NXDOMAIN or NODATA
+		return resp, nil
+	}
+	return nil, fmt.Errorf("resolving %s: too many referrals", name)
+}
+
+// chaseCNAME follows aliases in the answer that the authoritative server did not resolve itself.
+func (r *Resolver) chaseCNAME(msg *dns.Msg, qtype uint16, depth int, deadline time.Time) error {
+	target := msg.Question[0].Name
+	for i := 0; i < maxCNAMEChain; i++ {
+		next := cnameTarget(msg.Answer, target)
+		if next == "" {
+			return nil
+		}
+		target = next
+		if hasRecord(msg.Answer, target, qtype) {
+			return nil
+		}
+		if cnameTarget(msg.Answer, target) != "" {
+			// The chain continues within this answer
+			continue
+		}
+
+		resp, err := r.resolve(target, qtype, depth+1, deadline)
+		if err != nil {
+			return err
+		}
+		msg.Answer = append(msg.Answer, resp.Answer...)
+		msg.Ns = resp.Ns
+		msg.Rcode = resp.Rcode
+		if len(resp.Answer) == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("resolving %s: CNAME chain too long", msg.Question[0].Name)
+}
+
+// serversFor turns a referral into server addresses, using in-bailiwick glue
+// where present and resolving the name server names otherwise. IPv6
+// addresses are used too, after the IPv4 ones, so zones served only over
+// IPv6 still resolve while hosts without IPv6 lose no time.
+func (r *Resolver) serversFor(child string, nsNames []string, resp *dns.Msg, zone string, depth int, deadline time.Time) ([]string, error) {
+	wanted := make(map[string]bool)
+	for _, ns := range nsNames {
+		wanted[strings.ToLower(ns)] = true
+	}
+
+	var servers, servers6 []string
+	for _, rr := range resp.Extra {
+		owner := strings.ToLower(rr.Header().Name)
+		// Only trust glue the referring server is authoritative for
+		if !wanted[owner] || !dns.IsSubDomain(zone, owner) {
+			continue
+		}
+		switch glue := rr.(type) {
+		case *dns.A:
+			servers = append(servers, r.serverAddr(glue.A))
+		case *dns.AAAA:
+			servers6 = append(servers6, r.serverAddr(glue.AAAA))
+		}
+	}
+	servers = append(servers, servers6...)
+
+	if len(servers) == 0 {
+	lookup:
+		for _, ns := range nsNames {
+			// A glueless name server inside the child zone can never be resolved
+			if dns.IsSubDomain(child, ns) {
+				continue
+			}
+			for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+				addrs, err := r.resolve(ns, qtype, depth+1, deadline)
+				if err != nil {
+					continue
+				}
+				for _, rr := range addrs.Answer {
+					switch a := rr.(type) {
+					case *dns.A:
+						servers = append(servers, r.serverAddr(a.A))
+					case *dns.AAAA:
+						servers = append(servers, r.serverAddr(a.AAAA))
+					}
+				}
+				if len(servers) > 0 {
+					break lookup
+				}
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("delegation to %s: %w", child, errNoServers)
+	}
+
+	r.Cache.SetDelegation(child, servers, time.Duration(minTTL(resp.Ns))*time.Second)
+	return servers, nil
+}
+
+// serverAddr returns the address to query a name server at ip on.
+func (r *Resolver) serverAddr(ip net.IP) string {
+	port := r.port
+	if port == "" {
+		port = "53"
+	}
+	return net.JoinHostPort(ip.String(), port)
+}
+
+// query asks each server in turn until one gives a usable response, retrying over TCP when truncated.
+func (r *Resolver) query(servers []string, name string, qtype uint16, deadline time.Time) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(1232, false)
+
+	lastErr := errNoServers
+	for _, server := range servers {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return nil, errResolveTimeout
+		}
+		if timeout > r.QueryTimeout {
+			timeout = r.QueryTimeout
+		}
+
+		client := &dns.Client{Net: "udp", Timeout: timeout}
+		resp, _, err := client.Exchange(m, server)
+		if err == nil && resp.Truncated {
+			client.Net = "tcp"
+			resp, _, err = client.Exchange(m, server)
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// Lame or broken servers: try the next one
+		if resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+			lastErr = fmt.Errorf("%s answered %s", server, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// referral returns the delegated child zone and its name servers if resp is a referral below zone.
+func referral(resp *dns.Msg, zone string) (string, []string) {
+	if len(resp.Answer) > 0 || resp.Rcode != dns.RcodeSuccess {
+		return "", nil
+	}
+	child := ""
+	var names []string
+	for _, rr := range resp.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(ns.Hdr.Name)
+		// Must move strictly closer to the name, otherwise we would loop
+		if owner == zone || !dns.IsSubDomain(zone, owner) {
+			continue
+		}
+		if child == "" {
+			child = owner
+		}
+		if owner == child {
+			names = append(names, strings.ToLower(ns.Ns))
+		}
+	}
+	return child, names
+}
+
+// lastLabels returns the rightmost n labels of name, e.g. lastLabels("a.b.c.", 2) == "b.c.".
+func lastLabels(name string, n int) string {
+	idx := dns.Split(name)
+	if n >= len(idx) {
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+func cnameTarget(rrs []dns.RR, name string) string {
+	for _, rr := range rrs {
+		if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+			return strings.ToLower(cname.Target)
+		}
+	}
+	return ""
+}
+
+func hasType(rrs []dns.RR, rrtype uint16) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRecord(rrs []dns.RR, name string, rrtype uint16) bool {
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == rrtype && strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testNet runs fake name servers on loopback addresses. Glue carries
+// addresses but not ports, so every server listens on the same port.
+type testNet struct {
+	t    *testing.T
+	port string
+
+	mu      sync.Mutex
+	queries []string // "ip qname qtype net", in the order received
+}
+
+func newTestNet(t *testing.T) *testNet {
+	t.Helper()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+	pc.Close()
+	return &testNet{t: t, port: port}
+}
+
+// serve answers queries sent to ip over UDP and TCP with handler.
+func (n *testNet) serve(ip string, handler func(q dns.Question, tcp bool) *dns.Msg) {
+	n.t.Helper()
+	addr := net.JoinHostPort(ip, n.port)
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		n.t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		n.t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+
+	h := dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		q := req.Question[0]
+		tcp := w.RemoteAddr().Network() == "tcp"
+		n.mu.Lock()
+		n.queries = append(n.queries, fmt.Sprintf("%s %s %s %s", ip, q.Name, dns.TypeToString[q.Qtype], w.RemoteAddr().Network()))
+		n.mu.Unlock()
+
+		resp := handler(q, tcp)
+		if resp == nil {
+			resp = new(dns.Msg)
+			resp.Rcode = dns.RcodeRefused
+		}
+		rcode := resp.Rcode
+		resp.SetReply(req)
+		resp.Rcode = rcode
+		w.WriteMsg(resp)
+	})
+	for _, srv := range []*dns.Server{{PacketConn: pc, Handler: h}, {Listener: ln, Handler: h}} {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go srv.ActivateAndServe()
+		<-started
+		n.t.Cleanup(func() { srv.Shutdown() })
+	}
+}
+
+// resolver returns a resolver whose root server is at ip.
+func (n *testNet) resolver(ip string, minimise bool) *Resolver {
+	r := NewResolver([]string{net.JoinHostPort(ip, n.port)}, minimise)
+	r.port = n.port
+	r.QueryTimeout = time.Second
+	r.ResolveTimeout = 5 * time.Second
+	return r
+}
+
+// asked returns the queries received, leaving out the transport.
+func (n *testNet) asked() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var list []string
+	for _, q := range n.queries {
+		list = append(list, q[:strings.LastIndex(q, " ")])
+	}
+	return list
+}
+
+func rr(t *testing.T, s string) dns.RR {
+	t.Helper()
+	r, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return r
+}
+
+// referTo returns a referral to child, served by ns at glue.
+func referTo(t *testing.T, child string, ns string, glue string) *dns.Msg {
+	m := new(dns.Msg)
+	m.Ns = []dns.RR{rr(t, fmt.Sprintf("%s 3600 IN NS %s", child, ns))}
+	if glue != "" {
+		m.Extra = []dns.RR{rr(t, fmt.Sprintf("%s 3600 IN A %s", ns, glue))}
+	}
+	return m
+}
+
+// answer returns an authoritative answer holding records.
+func answer(t *testing.T, records ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.Authoritative = true
+	for _, s := range records {
+		m.Answer = append(m.Answer, rr(t, s))
+	}
+	return m
+}
+
+func answerStrings(msg *dns.Msg) []string {
+	var list []string
+	for _, r := range msg.Answer {
+		list = append(list, r.String())
+	}
+	return list
+}
+
+func TestResolveReferralWithGlue(t *testing.T) {
+	n := newTestNet(t)
+	n.serve("127.0.0.1", func(q dns.Question, tcp bool) *dns.Msg {
+		return referTo(t, "example.", "ns1.example.", "127.0.0.2")
+	})
+	n.serve("127.0.0.2", func(q dns.Question, tcp bool) *dns.Msg {
+		if q.Name == "www.example." && q.Qtype == dns.TypeA {
+			return answer(t, "www.example. 300 IN A 192.0.2.1")
+		}
+		return nil
+	})
+	r := n.resolver("127.0.0.1", false)
+
+	msg, err := r.Resolve("WWW.example", dns.TypeA)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if got, want := answerStrings(msg), []string{"www.example.\t300\tIN\tA\t192.0.2.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("answer = %q, want %q", got, want)
+	}
+	zone, servers := r.Cache.Delegation("mail.example.")
+	if want := []string{net.JoinHostPort("127.0.0.2", n.port)}; zone != "example." || !reflect.DeepEqual(servers, want) {
+		t.Errorf("cached delegation = %s %v, want example. %v", zone, servers, want)
+	}
+
+	// A second name in the zone skips the root
+	before := len(n.asked())
+	if _, err := r.Resolve("mail.example.", dns.TypeA); err == nil {
+		t.Error("unknown name resolved")
+	}
+	for _, q := range n.asked()[before:] {
+		if strings.HasPrefix(q, "127.0.0.1 ") {
+			t.Errorf("root asked %q despite the cached delegation", q)
+		}
+	}
+}
+
+func TestResolveChasesCNAME(t *testing.T) {
+	n := newTestNet(t)
+	n.serve("127.0.0.1", func(q dns.Question, tcp bool) *dns.Msg {
+		if dns.IsSubDomain("other.", q.Name) {
+			return referTo(t, "other.", "ns1.other.", "127.0.0.3")
+		}
+		return referTo(t, "example.", "ns1.example.", "127.0.0.2")
+	})
+	n.serve("127.0.0.2", func(q dns.Question, tcp bool) *dns.Msg {
+		if q.Name == "www.example." {
+			return answer(t, "www.example. 300 IN CNAME web.other.")
+		}
+		return nil
+	})
+	n.serve("127.0.0.3", func(q dns.Question, tcp bool) *dns.Msg {
+		if q.Name == "web.other." && q.Qtype == dns.TypeA {
+			return answer(t, "web.other. 300 IN A 192.0.2.7")
+		}
+		return nil
+	})
+	r := n.resolver("127.0.0.1", false)
+
+	msg, err := r.Resolve("www.example.", dns.TypeA)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	want := []string{
+		"www.example.\t300\tIN\tCNAME\tweb.other.",
+		"web.other.\t300\tIN\tA\t192.0.2.7",
+	}
+	if got := answerStrings(msg); !reflect.DeepEqual(got, want) {
+		t.Errorf("answer = %q, want %q", got, want)
+	}
+	if msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("rcode = %s", dns.RcodeToString[msg.Rcode])
+	}
+}
+
+func TestResolveQNAMEMinimisation(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		alias bool // c.example. is an alias, so minimising stops there
+		want  []string
+	}{
+		{
+			name: "empty non-terminals",
+			want: []string{
+				"127.0.0.1 example. NS",
+				"127.0.0.2 c.example. NS",
+				"127.0.0.2 b.c.example. NS",
+				"127.0.0.2 a.b.c.example. A",
+			},
+		},
+		{
+			name:  "alias fallback",
+			alias: true,
+			want: []string{
+				"127.0.0.1 example. NS",
+				"127.0.0.2 c.example. NS",
+				"127.0.0.2 a.b.c.example. A",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestNet(t)
+			n.serve("127.0.0.1", func(q dns.Question, tcp bool) *dns.Msg {
+				return referTo(t, "example.", "ns1.example.", "127.0.0.2")
+			})
+			n.serve("127.0.0.2", func(q dns.Question, tcp bool) *dns.Msg {
+				switch {
+				case q.Name == "a.b.c.example." && q.Qtype == dns.TypeA:
+					return answer(t, "a.b.c.example. 300 IN A 192.0.2.9")
+				case q.Name == "c.example." && tc.alias:
+					return answer(t, "c.example. 300 IN CNAME elsewhere.example.")
+				default:
+					// NODATA: the name exists but has no records of this type
+					return answer(t)
+				}
+			})
+			r := n.resolver("127.0.0.1", true)
+
+			msg, err := r.Resolve("a.b.c.example.", dns.TypeA)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if len(msg.Answer) != 1 {
+				t.Errorf("answer = %v, want the A record", msg.Answer)
+			}
+			if got := n.asked(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("queries = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveRetriesTruncatedOverTCP(t *testing.T) {
+	n := newTestNet(t)
+	n.serve("127.0.0.1", func(q dns.Question, tcp bool) *dns.Msg {
+		if !tcp {
+			m := new(dns.Msg)
+			m.Truncated = true
+			return m
+		}
+		return answer(t, `big.example. 300 IN TXT "too large for UDP"`)
+	})
+	r := n.resolver("127.0.0.1", false)
+
+	msg, err := r.Resolve("big.example.", dns.TypeTXT)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if len(msg.Answer) != 1 {
+		t.Errorf("answer = %v, want the TXT record", msg.Answer)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	want := []string{
+		"127.0.0.1 big.example. TXT udp",
+		"127.0.0.1 big.example. TXT tcp",
+	}
+	if !reflect.DeepEqual(n.queries, want) {
+		t.Errorf("queries = %q, want %q", n.queries, want)
+	}
+}
+
+func TestServersForUsesAAAAGlue(t *testing.T) {
+	r := NewResolver([]string{"127.0.0.1:53"}, false)
+	resp := new(dns.Msg)
+	resp.Ns = []dns.RR{
+		rr(t, "example. 3600 IN NS ns1.example."),
+		rr(t, "example. 3600 IN NS ns2.example."),
+	}
+	resp.Extra = []dns.RR{
+		rr(t, "ns2.example. 3600 IN AAAA 2001:db8::53"),
+		rr(t, "ns1.example. 3600 IN A 192.0.2.53"),
+		// Not one of the delegation's name servers
+		rr(t, "ns9.example. 3600 IN AAAA 2001:db8::99"),
+	}
+
+	servers, err := r.serversFor("example.", []string{"ns1.example.", "ns2.example."}, resp, ".", 0, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("serversFor: %v", err)
+	}
+	// IPv4 servers come first
+	if want := []string{"192.0.2.53:53", "[2001:db8::53]:53"}; !reflect.DeepEqual(servers, want) {
+		t.Errorf("servers = %v, want %v", servers, want)
+	}
+
+	// IPv6 glue alone is enough
+	resp.Extra = resp.Extra[:1]
+	servers, err = r.serversFor("example.", []string{"ns1.example.", "ns2.example."}, resp, ".", 0, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("serversFor with IPv6 glue only: %v", err)
+	}
+	if want := []string{"[2001:db8::53]:53"}; !reflect.DeepEqual(servers, want) {
+		t.Errorf("servers = %v, want %v", servers, want)
+	}
+}
@@ -2,29 +2,50 @@ package dns
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"homenet/internal/config"
+
 	"github.com/miekg/dns"
 )
 
+// Server states reported by State.
+const (
+	StateStopped   = "stopped"
+	StateListening = "listening"
+	StateFailed    = "failed"
+)
+
 // Server represents our DNS Gatekeeper.
 type Server struct {
 	Upstream       string
-	Mode           string // "udp", "doh", "dot"
+	Mode           string // "udp", "doh", "dot", "recursive"
 	DoHProvider    string
 	BlockList      map[string]bool
 	TotalQueries   uint64
 	BlockedQueries uint64
+	Privacy        config.PrivacyConfig
+	Resolver       *Resolver // Only set in "recursive" mode
+	Cache          *Cache
+	Stats          *QueryStats // Per-client and per-domain counters
+	Prefetches     uint64      // Background refreshes completed
+	prefetchSem    chan struct{}
+	server         *dns.Server
+	state          string
+	stateErr       error
 	mu             sync.RWMutex
 }
 
 // NewServer creates a new DNS server.
-func NewServer(upstream string, mode string, dohProvider string, blockList []string) *Server {
+func NewServer(upstream string, mode string, dohProvider string, blockList []string, privacy config.PrivacyConfig, prefetch config.PrefetchConfig) *Server {
 	if mode == "" {
 		mode = "udp"
 	}
@@ -33,6 +54,21 @@ func NewServer(upstream string, mode string, dohProvider string, blockList []str
 		Mode:        mode,
 		DoHProvider: dohProvider,
 		BlockList:   make(map[string]bool),
+		Privacy:     privacy,
+		Stats:       NewQueryStats(),
+		state:       StateStopped,
+	}
+	if mode == "recursive" {
+		// Share the resolver's cache so prefetches really go back to the authoritative servers
+		s.Resolver = NewResolver(nil, privacy.QNAMEMinimise)
+		s.Cache = s.Resolver.Cache
+	} else {
+		s.Cache = NewCache(defaultCacheSize)
+	}
+	if prefetch.Enabled {
+		s.Cache.PrefetchMinHits = uint64(prefetch.MinHits)
+		s.Cache.PrefetchThreshold = float64(prefetch.ThresholdPercent) / 100
+		s.prefetchSem = make(chan struct{}, prefetch.MaxConcurrent)
 	}
 	// Initialize blocklist
 	for _, domain := range blockList {
@@ -48,18 +84,75 @@ func (s *Server) GetStats() (uint64, uint64) {
 	return s.TotalQueries, s.BlockedQueries
 }
 
-// Start runs the DNS server on the specified port.
-func (s *Server) Start(port string) {
-	addr := fmt.Sprintf(":%s", port)
-	server := &dns.Server{Addr: addr, Net: "udp"}
+// Start binds the DNS server to the specified port on every interface, or to
+// a single address given as host:port, and serves it in the background.
+// Bind errors (e.g. port 53 already in use) are returned immediately.
+func (s *Server) Start(port string) error {
+	addr := port
+	if !strings.Contains(port, ":") {
+		addr = fmt.Sprintf(":%s", port)
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		s.setState(StateFailed, err)
+		return err
+	}
+
+	server := &dns.Server{PacketConn: pc, Net: "udp"}
 	server.Handler = dns.HandlerFunc(s.handleRequest)
 
-	log.Printf("Starting DNS Gatekeeper on port %s...", port)
+	s.mu.Lock()
+	s.server = server
+	s.mu.Unlock()
+	s.setState(StateListening, nil)
+
+	log.Printf("Starting DNS Gatekeeper on %s...", pc.LocalAddr())
 	go func() {
-		if err := server.ListenAndServe(); err != nil {
-			log.Printf("Failed to start DNS server: %s", err.Error())
+		if err := server.ActivateAndServe(); err != nil {
+			log.Printf("DNS server stopped: %s", err.Error())
+			s.setState(StateFailed, err)
 		}
 	}()
+	return nil
+}
+
+// Shutdown stops accepting queries and waits for in-flight ones to finish or ctx to expire.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	err := server.ShutdownContext(ctx)
+	s.setState(StateStopped, nil)
+	return err
+}
+
+// Addr returns the address the server is bound to, or nil when it is not running.
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.server == nil {
+		return nil
+	}
+	return s.server.PacketConn.LocalAddr()
+}
+
+// State returns the server state and, when it failed, the reason.
+func (s *Server) State() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state, s.stateErr
+}
+
+func (s *Server) setState(state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	s.stateErr = err
 }
 
 func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
@@ -67,6 +160,11 @@ func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 	m.SetReply(r)
 	m.Compress = false
 
+	client := ""
+	if host, _, err := net.SplitHostPort(w.RemoteAddr().String()); err == nil {
+		client = host
+	}
+
 	if r.Opcode == dns.OpcodeQuery {
 		for _, q := range m.Question {
 			s.mu.Lock()
@@ -76,6 +174,7 @@ func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 				s.BlockedQueries++
 			}
 			s.mu.Unlock()
+			s.Stats.Record(client, q.Name, blocked)
 
 			if blocked {
 				log.Printf("[BLOCKED] %s\n", q.Name)
@@ -83,16 +182,10 @@ func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 				m.SetRcode(r, dns.RcodeNameError)
 			} else {
 				// Forward to upstream
-				var resp *dns.Msg
-				var err error
-
-				if s.Mode == "doh" {
-					resp, err = s.resolveDoH(m)
-				} else {
-					resp, err = dns.Exchange(m, s.Upstream)
-				}
+				resp, err := s.forward(r)
 
 				if err == nil && resp != nil {
+					m.Rcode = resp.Rcode
 					m.Answer = resp.Answer
 					m.Extra = resp.Extra
 					m.Ns = resp.Ns
@@ -106,8 +199,74 @@ func (s *Server) handleRequest(w dns.ResponseWriter, r *dns.Msg) {
 	w.WriteMsg(m)
 }
 
+// forward answers from the cache when possible and asks upstream otherwise.
+func (s *Server) forward(r *dns.Msg) (*dns.Msg, error) {
+	q := r.Question[0]
+	if msg, refresh, ok := s.Cache.Lookup(q.Name, q.Qtype); ok {
+		if refresh {
+			s.prefetch(r.Copy())
+		}
+		return msg, nil
+	}
+
+	resp, err := s.fetch(r)
+	if err != nil {
+		return nil, err
+	}
+	s.Cache.Set(q.Name, q.Qtype, resp)
+	return resp, nil
+}
+
+// fetch resolves a query without looking at the cache, trying each upstream in turn.
+func (s *Server) fetch(r *dns.Msg) (*dns.Msg, error) {
+	if s.Resolver != nil {
+		q := r.Question[0]
+		return s.Resolver.Refresh(q.Name, q.Qtype)
+	}
+
+	q := s.prepareUpstream(r)
+
+	var lastErr error
+	for _, upstream := range s.upstreams() {
+		resp, err := s.exchange(q, upstream)
+		if err == nil && resp != nil {
+			return resp, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// exchange sends a single query to one upstream using the configured transport.
+func (s *Server) exchange(q *dns.Msg, upstream string) (*dns.Msg, error) {
+	switch s.Mode {
+	case "doh":
+		return s.resolveDoH(q, upstream)
+	case "dot":
+		// DNS over TLS (RFC 7858), e.g. "1.1.1.1:853"
+		client := &dns.Client{Net: "tcp-tls", Timeout: 5 * time.Second}
+		resp, _, err := client.Exchange(q, dotAddr(upstream))
+		return resp, err
+	default:
+		return dns.Exchange(q, upstream)
+	}
+}
+
+// dotAddr returns the address to reach upstream over TLS. Nothing serves TLS
+// on the plain DNS port, so a missing port or 53, as in the default
+// upstream_dns, means the DoT port 853.
+func dotAddr(upstream string) string {
+	host, port, err := net.SplitHostPort(upstream)
+	if err != nil {
+		host = strings.Trim(upstream, "[]")
+	} else if port != "53" {
+		return upstream
+	}
+	return net.JoinHostPort(host, "853")
+}
+
 // resolveDoH sends a DNS query over HTTPS (RFC 8484)
-func (s *Server) resolveDoH(m *dns.Msg) (*dns.Msg, error) {
+func (s *Server) resolveDoH(m *dns.Msg, provider string) (*dns.Msg, error) {
 	// Pack the DNS message into binary format
 	data, err := m.Pack()
 	if err != nil {
@@ -115,7 +274,7 @@ func (s *Server) resolveDoH(m *dns.Msg) (*dns.Msg, error) {
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", s.DoHProvider, bytes.NewReader(data))
+	req, err := http.NewRequest("POST", provider, bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,64 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"homenet/internal/config"
+
+	"github.com/miekg/dns"
+)
+
+func TestServerLifecycle(t *testing.T) {
+	s := NewServer("127.0.0.1:1", "udp", "", []string{"ads.example."}, config.PrivacyConfig{}, config.PrefetchConfig{})
+	if state, _ := s.State(); state != StateStopped {
+		t.Fatalf("new server is %s, want %s", state, StateStopped)
+	}
+
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	if state, err := s.State(); state != StateListening || err != nil {
+		t.Fatalf("started server is %s (%v), want %s", state, err, StateListening)
+	}
+	addr := s.Addr().String()
+
+	// It answers: a blocked name needs no upstream
+	q := new(dns.Msg)
+	q.SetQuestion("ads.example.", dns.TypeA)
+	resp, err := dns.Exchange(q, addr)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("rcode = %s, want NXDOMAIN", dns.RcodeToString[resp.Rcode])
+	}
+
+	// A second server on the same address fails to bind and says so
+	other := NewServer("127.0.0.1:1", "udp", "", nil, config.PrivacyConfig{}, config.PrefetchConfig{})
+	if err := other.Start(addr); err == nil {
+		other.Shutdown(context.Background())
+		t.Fatal("second server bound an address already in use")
+	}
+	if state, err := other.State(); state != StateFailed || err == nil {
+		t.Errorf("second server is %s (%v), want %s with the bind error", state, err, StateFailed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	// Give the serving goroutine time to return; it must not report a failure
+	time.Sleep(50 * time.Millisecond)
+	if state, err := s.State(); state != StateStopped || err != nil {
+		t.Errorf("shut down server is %s (%v), want %s", state, err, StateStopped)
+	}
+	if s.Addr() != nil {
+		t.Error("shut down server still has an address")
+	}
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("second Shutdown: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package dns
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Windows supported by QueryStats.Snapshot.
+var StatsWindows = map[string]time.Duration{
+	"1h":  time.Hour,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+const (
+	sketchSize     = 64              // Counters kept per key space per bucket
+	fineBucket     = 5 * time.Minute // Resolution of the 1h window
+	coarseBucket   = time.Hour       // Resolution of the 24h and 7d windows
+	fineBuckets    = 12
+	coarseBuckets  = 7 * 24
+	defaultTopSize = 10
+)
+
+// Counter is one entry of a top list.
+type Counter struct {
+	Key   string `json:"key"`
+	Count uint64 `json:"count"`
+}
+
+// StatsSnapshot summarises DNS activity over one window.
+type StatsSnapshot struct {
+	Window     string    `json:"window"`
+	Queries    uint64    `json:"queries"`
+	Blocked    uint64    `json:"blocked"`
+	TopDomains []Counter `json:"top_domains"`
+	TopBlocked []Counter `json:"top_blocked"`
+	TopClients []Counter `json:"top_clients"`
+	// Clients with the most blocked queries, usually the ones full of trackers
+	TopBlockedClients []Counter `json:"top_blocked_clients"`
+}
+
+// topK approximates the most frequent keys in bounded memory using the
+// Space-Saving algorithm: when full, the smallest counter is reassigned to the
+// new key, so counts can over-estimate but heavy hitters are never lost.
+type topK struct {
+	size   int
+	counts map[string]uint64
+}
+
+func newTopK(size int) *topK {
+	return &topK{size: size, counts: make(map[string]uint64, size)}
+}
+
+func (t *topK) add(key string, n uint64) {
+	if _, ok := t.counts[key]; ok || len(t.counts) < t.size {
+		t.counts[key] += n
+		return
+	}
+
+	minKey, minCount := "", uint64(0)
+	for k, c := range t.counts {
+		if minKey == "" || c < minCount {
+			minKey, minCount = k, c
+		}
+	}
+	delete(t.counts, minKey)
+	t.counts[key] = minCount + n
+}
+
+type statsBucket struct {
+	start          time.Time
+	queries        uint64
+	blocked        uint64
+	domains        *topK
+	blockedDomains *topK
+	clients        *topK
+	blockedClients *topK
+}
+
+func (b *statsBucket) reset(start time.Time) {
+	b.start = start
+	b.queries = 0
+	b.blocked = 0
+	b.domains = newTopK(sketchSize)
+	b.blockedDomains = newTopK(sketchSize)
+	b.clients = newTopK(sketchSize)
+	b.blockedClients = newTopK(sketchSize)
+}
+
+// QueryStats keeps rolling per-client and per-domain counters.
+// Recent activity is kept in 5 minute buckets for the last hour and hourly
+// buckets for the last week.
+type QueryStats struct {
+	mu     sync.Mutex
+	fine   []statsBucket
+	coarse []statsBucket
+}
+
+// NewQueryStats creates an empty statistics store.
+func NewQueryStats() *QueryStats {
+	return &QueryStats{
+		fine:   make([]statsBucket, fineBuckets),
+		coarse: make([]statsBucket, coarseBuckets),
+	}
+}
+
+// Record counts one query from client for domain.
+func (st *QueryStats) Record(client, domain string, blocked bool) {
+	st.record(client, domain, blocked, time.Now())
+}
+
+func (st *QueryStats) record(client, domain string, blocked bool, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, b := range []*statsBucket{
+		bucketFor(st.fine, fineBucket, now),
+		bucketFor(st.coarse, coarseBucket, now),
+	} {
+		b.queries++
+		b.domains.add(domain, 1)
+		b.clients.add(client, 1)
+		if blocked {
+			b.blocked++
+			b.blockedDomains.add(domain, 1)
+			b.blockedClients.add(client, 1)
+		}
+	}
+}
+
+// bucketFor returns the ring bucket covering t, clearing it if it holds older data.
+func bucketFor(ring []statsBucket, width time.Duration, t time.Time) *statsBucket {
+	start := t.Truncate(width)
+	b := &ring[int(start.Unix()/int64(width.Seconds()))%len(ring)]
+	if !b.start.Equal(start) {
+		b.reset(start)
+	}
+	return b
+}
+
+// Snapshot returns totals and the top n entries for a window name ("1h", "24h" or "7d").
+func (st *QueryStats) Snapshot(window string, n int) StatsSnapshot {
+	return st.snapshot(window, n, time.Now())
+}
+
+func (st *QueryStats) snapshot(window string, n int, now time.Time) StatsSnapshot {
+	d, ok := StatsWindows[window]
+	if !ok {
+		window, d = "24h", StatsWindows["24h"]
+	}
+	if n <= 0 {
+		n = defaultTopSize
+	}
+
+	ring, width := st.coarse, coarseBucket
+	if d <= time.Hour {
+		ring, width = st.fine, fineBucket
+	}
+	since := now.Add(-d).Truncate(width)
+
+	domains := make(map[string]uint64)
+	blockedDomains := make(map[string]uint64)
+	clients := make(map[string]uint64)
+	blockedClients := make(map[string]uint64)
+	snap := StatsSnapshot{Window: window}
+
+	st.mu.Lock()
+	for i := range ring {
+		b := &ring[i]
+		if b.domains == nil || !b.start.After(since) {
+			continue
+		}
+		snap.Queries += b.queries
+		snap.Blocked += b.blocked
+		merge(domains, b.domains)
+		merge(blockedDomains, b.blockedDomains)
+		merge(clients, b.clients)
+		merge(blockedClients, b.blockedClients)
+	}
+	st.mu.Unlock()
+
+	snap.TopDomains = top(domains, n)
+	snap.TopBlocked = top(blockedDomains, n)
+	snap.TopClients = top(clients, n)
+	snap.TopBlockedClients = top(blockedClients, n)
+	return snap
+}
+
+func merge(dst map[string]uint64, t *topK) {
+	for k, c := range t.counts {
+		dst[k] += c
+	}
+}
+
+func top(counts map[string]uint64, n int) []Counter {
+	list := make([]Counter, 0, len(counts))
+	for k, c := range counts {
+		list = append(list, Counter{Key: k, Count: c})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Key < list[j].Key
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
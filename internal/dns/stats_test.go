@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTopKEvictsSmallest(t *testing.T) {
+	k := newTopK(3)
+	k.add("a", 5)
+	k.add("b", 2)
+	k.add("c", 3)
+	k.add("a", 1)
+
+	// Full: the new key takes over the smallest counter and inherits its count
+	k.add("d", 1)
+	if want := map[string]uint64{"a": 6, "c": 3, "d": 3}; !reflect.DeepEqual(k.counts, want) {
+		t.Fatalf("counts = %v, want %v", k.counts, want)
+	}
+
+	// A heavy hitter arriving late still surfaces
+	for i := 0; i < 10; i++ {
+		k.add("e", 1)
+	}
+	if got := top(k.counts, 1); got[0].Key != "e" {
+		t.Errorf("top = %v, want e first", got)
+	}
+	if len(k.counts) != 3 {
+		t.Errorf("kept %d counters, want 3", len(k.counts))
+	}
+}
+
+func TestTopKNeverUnderestimates(t *testing.T) {
+	// Space-Saving guarantees keys seen more than total/size times are kept
+	k := newTopK(8)
+	exact := make(map[string]uint64)
+	for i := 0; i < 200; i++ {
+		// A few popular keys among a long tail of one-off names
+		key := fmt.Sprintf("tail%d", i)
+		if i%3 == 0 {
+			key = fmt.Sprintf("hot%d", i%2)
+		}
+		k.add(key, 1)
+		exact[key]++
+	}
+	for _, hot := range []string{"hot0", "hot1"} {
+		if k.counts[hot] < exact[hot] {
+			t.Errorf("%s counted %d, below its true %d", hot, k.counts[hot], exact[hot])
+		}
+	}
+}
+
+func TestStatsWindows(t *testing.T) {
+	st := NewQueryStats()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	st.record("10.0.0.2", "old.example.", false, now.Add(-3*time.Hour))
+	st.record("10.0.0.2", "ads.example.", true, now.Add(-90*time.Minute))
+	st.record("10.0.0.3", "www.example.", false, now.Add(-10*time.Minute))
+	st.record("10.0.0.3", "www.example.", false, now)
+
+	for _, tc := range []struct {
+		window           string
+		queries, blocked uint64
+		domains          []Counter
+	}{
+		{"1h", 2, 0, []Counter{{"www.example.", 2}}},
+		{"24h", 4, 1, []Counter{{"www.example.", 2}, {"ads.example.", 1}, {"old.example.", 1}}},
+		{"7d", 4, 1, []Counter{{"www.example.", 2}, {"ads.example.", 1}, {"old.example.", 1}}},
+	} {
+		snap := st.snapshot(tc.window, 10, now)
+		if snap.Queries != tc.queries || snap.Blocked != tc.blocked || !reflect.DeepEqual(snap.TopDomains, tc.domains) {
+			t.Errorf("%s: %d queries, %d blocked, top %v; want %d, %d, %v",
+				tc.window, snap.Queries, snap.Blocked, snap.TopDomains, tc.queries, tc.blocked, tc.domains)
+		}
+	}
+	if snap := st.snapshot("24h", 10, now); !reflect.DeepEqual(snap.TopBlockedClients, []Counter{{"10.0.0.2", 1}}) {
+		t.Errorf("top blocked clients = %v", snap.TopBlockedClients)
+	}
+
+	// An hour later the 5 minute ring has wrapped: the slot that held the
+	// query at noon is reused and its old count dropped
+	later := now.Add(time.Hour)
+	st.record("10.0.0.4", "new.example.", false, later)
+	snap := st.snapshot("1h", 10, later)
+	if want := []Counter{{"new.example.", 1}}; snap.Queries != 1 || !reflect.DeepEqual(snap.TopDomains, want) {
+		t.Errorf("1h after rollover: %d queries, top %v; want 1, %v", snap.Queries, snap.TopDomains, want)
+	}
+
+	// A week on the hourly ring has wrapped too, and the slot reused for
+	// this hour no longer holds the query from a week ago
+	later = now.Add(7 * 24 * time.Hour)
+	st.record("10.0.0.4", "new.example.", false, later)
+	if snap := st.snapshot("7d", 10, later); snap.Queries != 2 {
+		t.Errorf("7d a week later: %d queries, want the 2 from the last week", snap.Queries)
+	}
+}
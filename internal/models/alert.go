@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Kinds of security alert.
+const (
+	AlertGatewaySpoof = "gateway_spoof" // The gateway IP answered from an unexpected MAC
+	AlertIPConflict   = "ip_conflict"   // An IP keeps switching between MACs
+	AlertMACMultiIP   = "mac_multi_ip"  // One MAC claims many IPs
+	AlertRogueDHCP    = "rogue_dhcp"    // A DHCP server not on the trusted list made an offer
+)
+
+// SecurityAlert is an anomaly in IP to MAC bindings that may mean ARP
+// spoofing or a misconfigured device.
+type SecurityAlert struct {
+	Kind    string    `json:"kind"`
+	IP      string    `json:"ip,omitempty"`
+	MACs    []string  `json:"macs"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
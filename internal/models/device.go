@@ -1,19 +1,80 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Device represents a device discovered on the network.
 type Device struct {
+	ID          string    `json:"id"`                     // Stable identity, e.g. "mac-aabbccddeeff" or "ip-10.0.0.5"
 	IP          string    `json:"ip"`
 	Hostname    string    `json:"hostname,omitempty"`
 	MAC         string    `json:"mac,omitempty"`
 	Manufacturer string   `json:"manufacturer,omitempty"` // Derived from MAC OUI
-	Ports       []string  `json:"ports,omitempty"`        // List of open services (e.g., "80/http")
+	Ports       []Port    `json:"ports,omitempty"`        // Open services (e.g., 80/tcp http)
 	LastSeen    time.Time `json:"last_seen"`
 	IsOnline    bool      `json:"is_online"`
 	
 	// Enhanced Discovery Fields
-	FriendlyName string            `json:"friendly_name,omitempty"` // User-defined or mDNS name
-	DeviceType   string            `json:"device_type,omitempty"`   // e.g., "Phone", "TV", "IoT"
-	MDNSInfo     map[string]string `json:"mdns_info,omitempty"`     // Raw mDNS TXT records
+	FriendlyName   string        `json:"friendly_name,omitempty"`   // User-defined or mDNS name
+	DeviceType     string        `json:"device_type,omitempty"`     // e.g., "Phone", "TV", "IoT"
+	TypeOverride   string        `json:"type_override,omitempty"`   // Set by the user; wins over the classifier
+	TypeConfidence int           `json:"type_confidence,omitempty"` // 0-100, how sure the classifier is
+	TypeEvidence   []string      `json:"type_evidence,omitempty"`   // Rules behind the type, e.g. "mDNS _ipp._tcp (+80)"
+	MDNSServices   []MDNSService `json:"mdns_services,omitempty"`   // Every DNS-SD instance the device advertises
+	IPv6           []string      `json:"ipv6,omitempty"`            // IPv6 addresses from mDNS and the neighbor table, link-local first
+	ModelName      string        `json:"model_name,omitempty"`      // From the UPnP description, e.g. "Bravia 4K"
+	ModelNumber    string        `json:"model_number,omitempty"`
+	UPnPType       string        `json:"upnp_type,omitempty"`     // Root device type, e.g. "MediaRenderer:1"
+	UPnPServices   []string      `json:"upnp_services,omitempty"` // e.g. "AVTransport:1", "WANIPConnection:1"
+
+	// Presence Probing
+	RTT      time.Duration `json:"rtt,omitempty"`      // Last ICMP echo round-trip time
+	Evidence []string      `json:"evidence,omitempty"` // Probes that answered in the last scan, e.g. "arp", "icmp"
+
+	// IPv6 Address Aging
+	IPv6Seen map[string]time.Time `json:"ipv6_seen,omitempty"` // When each address in IPv6 was last seen
+
+	// Name Sources
+	Names          map[string]string `json:"names,omitempty"`           // Name reported by each source, e.g. {"netbios": "DESKTOP-4F2"}
+	HostnameSource string            `json:"hostname_source,omitempty"` // Source Hostname was taken from
+
+	// Identity
+	FirstSeen    time.Time `json:"first_seen"`              // When the device first appeared
+	IPHistory    []IPLease `json:"ip_history,omitempty"`    // Addresses this device has used, oldest first
+	PreviousMACs []string  `json:"previous_macs,omitempty"` // Randomized MACs it used before the current one
+
+	// DHCP and TCP Fingerprinting
+	VendorClass     string `json:"vendor_class,omitempty"`     // DHCP option 60, e.g. "MSFT 5.0"
+	DHCPFingerprint string `json:"dhcp_fingerprint,omitempty"` // DHCP option 55 as decimal codes, e.g. "1,3,6,15"
+	OSGuess         string `json:"os_guess,omitempty"`         // e.g. "Windows", "iOS"
+	OSSource        string `json:"os_source,omitempty"`        // What OSGuess was derived from: "dhcp" or "tcp"
+	TCPFingerprint  string `json:"tcp_fingerprint,omitempty"`  // Initial TTL, window and options of a SYN-ACK, e.g. "64:65160:M,S,T,N,W"
+}
+
+// UnmarshalJSON decodes a device, expanding the port labels older versions
+// wrote that stood for more than one port.
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type plain Device
+	v := struct {
+		*plain
+		Ports json.RawMessage `json:"ports,omitempty"`
+	}{plain: (*plain)(d)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	ports, err := unmarshalPorts(v.Ports)
+	if err != nil {
+		return err
+	}
+	d.Ports = ports
+	return nil
+}
+
+// IPLease is one address a device held and when it was seen there.
+type IPLease struct {
+	IP        string    `json:"ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DHCPServer is a server that answered our DHCPDISCOVER.
+type DHCPServer struct {
+	IP        string    `json:"ip"`               // Server identifier (option 54), else the source address
+	MAC       string    `json:"mac,omitempty"`    // From the device list, when known
+	OfferedIP string    `json:"offered_ip"`       // Address it offered our probe
+	Router    string    `json:"router,omitempty"` // Option 3
+	DNS       []string  `json:"dns,omitempty"`    // Option 6
+	LastOffer time.Time `json:"last_offer"`
+	Trusted   bool      `json:"trusted"`
+}
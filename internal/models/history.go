@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Transition is a device going online or offline.
+type Transition struct {
+	At     time.Time `json:"at"`
+	Online bool      `json:"online"`
+}
+
+// Session is one continuous period a device was online.
+type Session struct {
+	Start   time.Time
+	End     time.Time // Last time it was online; now for an ongoing session
+	Ongoing bool
+}
+
+// Duration is how long the session lasted (so far).
+func (s Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// PresenceSummary is what the presence history says about one device.
+type PresenceSummary struct {
+	FirstSeen time.Time
+	Uptime24h float64   // Percent of the last 24 hours spent online
+	Uptime7d  float64   // Percent of the last 7 days spent online
+	Sessions  []Session // Most recent first
+	Last24h   []bool    // Online at any point in each half hour, oldest first
+}
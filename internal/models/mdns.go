@@ -0,0 +1,10 @@
+package models
+
+// MDNSService is one DNS-SD service instance a device advertises.
+type MDNSService struct {
+	Instance string            `json:"instance"` // e.g., "Living Room"
+	Service  string            `json:"service"`  // e.g., "_googlecast._tcp"
+	Host     string            `json:"host"`     // SRV target, e.g., "Chromecast-1a2b.local"
+	Port     int               `json:"port"`
+	TXT      map[string]string `json:"txt,omitempty"` // All TXT key/value pairs
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Port is an open network service found on a device.
+type Port struct {
+	Number   int    `json:"number"`
+	Protocol string `json:"protocol"`          // "tcp"
+	Service  string `json:"service,omitempty"` // e.g., "ssh", "http"
+
+	// Banner Grabbing
+	Banner  string    `json:"banner,omitempty"`  // First line sent by the server, e.g. "SSH-2.0-OpenSSH_9.2p1"
+	Product string    `json:"product,omitempty"` // Software and version, e.g. "OpenSSH_9.2p1", "nginx/1.18.0"
+	Title   string    `json:"title,omitempty"`   // HTML <title> of the web page
+	TLS     *TLSInfo  `json:"tls,omitempty"`     // Certificate presented on TLS ports
+	Grabbed time.Time `json:"grabbed,omitempty"` // When the banner was last fetched
+}
+
+// TLSInfo summarises the leaf certificate of a TLS service.
+type TLSInfo struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// Expired reports whether the certificate is no longer valid.
+func (t *TLSInfo) Expired() bool {
+	return time.Now().After(t.NotAfter)
+}
+
+// legacyPortLabels maps the labels older versions stored in devices.json.
+// HTTP-ALT was written for both 8000 and 8080.
+var legacyPortLabels = map[string][]Port{
+	"HTTP":     {{Number: 80, Protocol: "tcp", Service: "http"}},
+	"HTTPS":    {{Number: 443, Protocol: "tcp", Service: "https"}},
+	"SSH":      {{Number: 22, Protocol: "tcp", Service: "ssh"}},
+	"DNS":      {{Number: 53, Protocol: "tcp", Service: "domain"}},
+	"HTTP-ALT": {{Number: 8000, Protocol: "tcp", Service: "http-alt"}, {Number: 8080, Protocol: "tcp", Service: "http-alt"}},
+	"iOS-Sync": {{Number: 62078, Protocol: "tcp", Service: "iphone-sync"}},
+	"mDNS":     {{Number: 5353, Protocol: "tcp", Service: "mdns"}},
+	"RDP":      {{Number: 3389, Protocol: "tcp", Service: "rdp"}},
+	"UPnP":     {{Number: 5000, Protocol: "tcp", Service: "upnp"}},
+}
+
+// String returns e.g. "ssh (22/tcp)".
+func (p Port) String() string {
+	if p.Service == "" {
+		return fmt.Sprintf("%d/%s", p.Number, p.Protocol)
+	}
+	return fmt.Sprintf("%s (%d/%s)", p.Service, p.Number, p.Protocol)
+}
+
+// Label returns a short name for tables: the service if known, else the number.
+func (p Port) Label() string {
+	if p.Service != "" {
+		return p.Service
+	}
+	return fmt.Sprintf("%d", p.Number)
+}
+
+// UnmarshalJSON also accepts the plain string labels ("SSH", "HTTP") written by
+// older versions, so existing devices.json files keep loading. A label that
+// stood for several ports decodes to the first; see unmarshalPorts.
+func (p *Port) UnmarshalJSON(data []byte) error {
+	var label string
+	if err := json.Unmarshal(data, &label); err == nil {
+		if legacy, ok := legacyPortLabels[label]; ok {
+			*p = legacy[0]
+			return nil
+		}
+		*p = Port{Protocol: "tcp", Service: label}
+		return nil
+	}
+
+	type plain Port
+	var v plain
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Port(v)
+	return nil
+}
+
+// unmarshalPorts decodes a port list, expanding legacy labels to every port
+// they stood for and dropping the duplicates that leaves.
+func unmarshalPorts(data []byte) ([]Port, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	type key struct {
+		number   int
+		protocol string
+	}
+	ports := make([]Port, 0, len(raw))
+	seen := make(map[key]bool)
+	add := func(p Port) {
+		k := key{p.Number, p.Protocol}
+		// Labels of unknown services carry no number; keep each of them
+		if p.Number == 0 || !seen[k] {
+			seen[k] = true
+			ports = append(ports, p)
+		}
+	}
+	for _, item := range raw {
+		var label string
+		if json.Unmarshal(item, &label) == nil {
+			if legacy, ok := legacyPortLabels[label]; ok {
+				for _, p := range legacy {
+					add(p)
+				}
+				continue
+			}
+		}
+		var p Port
+		if err := json.Unmarshal(item, &p); err != nil {
+			return nil, err
+		}
+		add(p)
+	}
+	return ports, nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDeviceLegacyPortLabels(t *testing.T) {
+	data := `{"id": "mac-001122334455", "ip": "10.0.0.5", "ports": ["SSH", "HTTP-ALT", "HTTP-ALT", "Telnet"]}`
+	var dev Device
+	if err := json.Unmarshal([]byte(data), &dev); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := []Port{
+		{Number: 22, Protocol: "tcp", Service: "ssh"},
+		{Number: 8000, Protocol: "tcp", Service: "http-alt"},
+		{Number: 8080, Protocol: "tcp", Service: "http-alt"},
+		{Protocol: "tcp", Service: "Telnet"},
+	}
+	if !reflect.DeepEqual(dev.Ports, want) {
+		t.Errorf("ports = %+v, want %+v", dev.Ports, want)
+	}
+	if dev.ID != "mac-001122334455" || dev.IP != "10.0.0.5" {
+		t.Errorf("other fields lost: %+v", dev)
+	}
+}
+
+func TestDevicePortsRoundTrip(t *testing.T) {
+	dev := Device{ID: "ip-10.0.0.6", Ports: []Port{{Number: 8080, Protocol: "tcp", Service: "http-alt", Banner: "nginx"}}}
+	data, err := json.Marshal(dev)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var back Device
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(back.Ports, dev.Ports) {
+		t.Errorf("ports = %+v, want %+v", back.Ports, dev.Ports)
+	}
+}
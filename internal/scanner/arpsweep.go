@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// arpReplyTimeout is how long we keep listening once the first ARP requests
+// are out. The re-sends to silent targets fall inside this window.
+const arpReplyTimeout = 2 * time.Second
+
+// arpAttempts is how many times a silent target is asked before the sweep
+// gives up on it. A single lost broadcast, or a phone slow to wake its radio,
+// should not be enough to mark a host absent.
+const arpAttempts = 3
+
+// errARPUnsupported is returned where raw link-layer sockets are not implemented.
+var errARPUnsupported = errors.New("ARP sweep not supported on this platform")
+
+// arpProbe asks every target on a directly attached network for its MAC.
+type arpProbe struct {
+	failed bool // The sweep could not open a socket; logged once
+}
+
+func (p *arpProbe) Name() string { return EvidenceARP }
+
+// Run reports the targets the sweep could ask. Those that stayed silent through
+// every attempt are absent: a host that ignores ARP on its own link cannot
+// answer TCP either.
+func (p *arpProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	replies, covered := p.sweep(ctx, targets)
+	var list []Observation
+	for _, ip := range targets {
+		if !covered[ip] {
+			continue
+		}
+		mac, ok := replies[ip]
+		list = append(list, Observation{IP: ip, MAC: mac, Answered: ok, Absent: !ok})
+	}
+	return list, nil
+}
+
+// sweep sends an ARP who-has for every target on a directly attached network
+// and returns the MAC of each host that answered. covered lists the targets the
+// sweep was able to ask; the rest must be probed another way. If raw sockets
+// are not permitted, covered is empty and the caller falls back to TCP.
+// The sweep ends early once ctx is done.
+func (p *arpProbe) sweep(ctx context.Context, targets []string) (map[string]string, map[string]bool) {
+	replies := make(map[string]string)
+	covered := make(map[string]bool)
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return replies, covered
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+
+			var local []net.IP
+			for _, t := range targets {
+				ip := net.ParseIP(t)
+				if ip != nil && !covered[t] && ipnet.Contains(ip) && !ip.Equal(ipnet.IP) {
+					local = append(local, ip)
+				}
+			}
+			if len(local) == 0 {
+				continue
+			}
+
+			found, err := arpScan(ctx, &iface, ipnet.IP.To4(), local, arpReplyTimeout)
+			if ctx.Err() != nil {
+				return replies, covered
+			}
+			if err != nil {
+				if !p.failed {
+					log.Printf("ARP sweep unavailable on %s, falling back to TCP probes: %v", iface.Name, err)
+					p.failed = true
+				}
+				continue
+			}
+			for _, ip := range local {
+				covered[ip.String()] = true
+			}
+			for ip, mac := range found {
+				replies[ip] = mac.String()
+			}
+		}
+	}
+	return replies, covered
+}
+
+// arpRequest builds an Ethernet broadcast frame asking who has target.
+func arpRequest(srcMAC net.HardwareAddr, srcIP, target net.IP) ([]byte, error) {
+	eth := layers.Ethernet{
+		SrcMAC:       srcMAC,
+		DstMAC:       layers.EthernetBroadcast,
+		EthernetType: layers.EthernetTypeARP,
+	}
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   []byte(srcMAC),
+		SourceProtAddress: []byte(srcIP.To4()),
+		DstHwAddress:      []byte{0, 0, 0, 0, 0, 0},
+		DstProtAddress:    []byte(target.To4()),
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, &eth, &arp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// arpReplies collects the answers to a sweep. The reader adds replies while
+// the sender decides which targets to ask again, so access is locked.
+type arpReplies struct {
+	mu     sync.Mutex
+	wanted map[string]bool
+	found  map[string]net.HardwareAddr
+}
+
+func newARPReplies(targets []net.IP) *arpReplies {
+	r := &arpReplies{wanted: make(map[string]bool, len(targets)), found: make(map[string]net.HardwareAddr)}
+	for _, ip := range targets {
+		r.wanted[ip.String()] = true
+	}
+	return r
+}
+
+// add records frame if it is a reply from one of the targets.
+func (r *arpReplies) add(frame []byte) {
+	ip, mac, ok := parseARPReply(frame)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	if r.wanted[ip.String()] {
+		r.found[ip.String()] = mac
+	}
+	r.mu.Unlock()
+}
+
+// silent returns the targets that have not answered yet.
+func (r *arpReplies) silent(targets []net.IP) []net.IP {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var list []net.IP
+	for _, ip := range targets {
+		if _, ok := r.found[ip.String()]; !ok {
+			list = append(list, ip)
+		}
+	}
+	return list
+}
+
+// result returns a copy of the replies collected so far.
+func (r *arpReplies) result() map[string]net.HardwareAddr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := make(map[string]net.HardwareAddr, len(r.found))
+	for ip, mac := range r.found {
+		found[ip] = mac
+	}
+	return found
+}
+
+// askARP sends a request to every target with send, then asks the ones that
+// stayed silent again, up to arpAttempts rounds spread evenly over timeout.
+// It returns once the last round has had its share of the window, or early
+// if every target answered or ctx is done.
+func askARP(ctx context.Context, targets []net.IP, replies *arpReplies, timeout time.Duration, send func(net.IP) error) error {
+	pending := targets
+	for attempt := 0; attempt < arpAttempts && len(pending) > 0; attempt++ {
+		for _, ip := range pending {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := send(ip); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-time.After(timeout / arpAttempts):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		pending = replies.silent(pending)
+	}
+	return nil
+}
+
+// parseARPReply extracts the sender of an ARP reply frame.
+func parseARPReply(frame []byte) (net.IP, net.HardwareAddr, bool) {
+	packet := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.NoCopy)
+	layer := packet.Layer(layers.LayerTypeARP)
+	if layer == nil {
+		return nil, nil, false
+	}
+	arp := layer.(*layers.ARP)
+	if arp.Operation != layers.ARPReply || len(arp.SourceProtAddress) != 4 {
+		return nil, nil, false
+	}
+	ip := net.IP(append([]byte(nil), arp.SourceProtAddress...))
+	mac := net.HardwareAddr(append([]byte(nil), arp.SourceHwAddress...))
+	return ip, mac, true
+}
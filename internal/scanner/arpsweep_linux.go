@@ -0,0 +1,82 @@
+//go:build linux
+
+package scanner
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func htons(v uint16) uint16 { return v<<8 | v>>8 }
+
+// arpScan asks for targets out of iface using an AF_PACKET socket, repeating
+// the request to silent targets within timeout, and collects replies until
+// the window is over or ctx is done. Requires CAP_NET_RAW; without it the socket call fails with EPERM.
+func arpScan(ctx context.Context, iface *net.Interface, src net.IP, targets []net.IP, timeout time.Duration) (map[string]net.HardwareAddr, error) {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(htons(unix.ETH_P_ARP)))
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ARP), Ifindex: iface.Index}); err != nil {
+		return nil, err
+	}
+	// Short read timeout so the reader can notice when to stop
+	tv := unix.NsecToTimeval((100 * time.Millisecond).Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	replies := newARPReplies(targets)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				continue
+			}
+			replies.add(buf[:n])
+		}
+	}()
+
+	dst := &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ARP),
+		Ifindex:  iface.Index,
+		Halen:    6,
+	}
+	copy(dst.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	err = askARP(ctx, targets, replies, timeout, func(ip net.IP) error {
+		frame, err := arpRequest(iface.HardwareAddr, src, ip)
+		if err != nil {
+			return err
+		}
+		if err := unix.Sendto(fd, frame, 0, dst); err != nil {
+			return err
+		}
+		// Pace requests so small switches and IoT stacks keep up
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	close(stop)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return replies.result(), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package scanner
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+func arpScan(ctx context.Context, iface *net.Interface, src net.IP, targets []net.IP, timeout time.Duration) (map[string]net.HardwareAddr, error) {
+	return nil, errARPUnsupported
+}
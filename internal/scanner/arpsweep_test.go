@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// arpReplyFrame builds the frame a host at ip with mac sends to answer.
+func arpReplyFrame(t *testing.T, ip, mac string) []byte {
+	t.Helper()
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth := layers.Ethernet{SrcMAC: hw, DstMAC: hw, EthernetType: layers.EthernetTypeARP}
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPReply,
+		SourceHwAddress:   []byte(hw),
+		SourceProtAddress: []byte(net.ParseIP(ip).To4()),
+		DstHwAddress:      []byte(hw),
+		DstProtAddress:    []byte{10, 9, 0, 100},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, &eth, &arp); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAskARPRetriesSilentTargets(t *testing.T) {
+	targets := []net.IP{net.ParseIP("10.9.0.1"), net.ParseIP("10.9.0.2"), net.ParseIP("10.9.0.3")}
+	replies := newARPReplies(targets)
+	src, _ := net.ParseMAC("00:11:22:33:44:55")
+
+	// 10.9.0.1 answers at once, 10.9.0.2 only the last request, 10.9.0.3 never
+	answerOn := map[string]int{"10.9.0.1": 1, "10.9.0.2": arpAttempts}
+	asked := make(map[string]int)
+	send := func(ip net.IP) error {
+		asked[ip.String()]++
+		if asked[ip.String()] == answerOn[ip.String()] {
+			replies.add(arpReplyFrame(t, ip.String(), "00:11:22:33:44:0"+ip.String()[len(ip.String())-1:]))
+		}
+		// Noise on the link: our own request and a reply from a stranger
+		req, _ := arpRequest(src, net.ParseIP("10.9.0.100"), ip)
+		replies.add(req)
+		replies.add(arpReplyFrame(t, "10.9.0.9", "00:11:22:33:44:09"))
+		return nil
+	}
+
+	if err := askARP(context.Background(), targets, replies, 30*time.Millisecond, send); err != nil {
+		t.Fatalf("askARP: %v", err)
+	}
+	if want := map[string]int{"10.9.0.1": 1, "10.9.0.2": arpAttempts, "10.9.0.3": arpAttempts}; !reflect.DeepEqual(asked, want) {
+		t.Errorf("requests sent = %v, want %v", asked, want)
+	}
+
+	found := replies.result()
+	if len(found) != 2 || found["10.9.0.1"].String() != "00:11:22:33:44:01" || found["10.9.0.2"].String() != "00:11:22:33:44:02" {
+		t.Errorf("replies = %v, want 10.9.0.1 and 10.9.0.2", found)
+	}
+	if silent := replies.silent(targets); len(silent) != 1 || !silent[0].Equal(targets[2]) {
+		t.Errorf("silent = %v, want only 10.9.0.3 after every attempt", silent)
+	}
+}
+
+func TestAskARPCancelled(t *testing.T) {
+	targets := []net.IP{net.ParseIP("10.9.0.1")}
+	ctx, cancel := context.WithCancel(context.Background())
+	sent := 0
+	err := askARP(ctx, targets, newARPReplies(targets), time.Hour, func(net.IP) error {
+		sent++
+		cancel()
+		return nil
+	})
+	if err == nil || sent != 1 {
+		t.Errorf("cancelled sweep returned %v after %d requests, want an error after 1", err, sent)
+	}
+}
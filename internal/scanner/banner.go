@@ -0,0 +1,216 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"homenet/internal/models"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	bannerTimeout = 2 * time.Second
+	bannerMaxAge  = time.Hour // Banners are refreshed at most this often
+	bannerMaxBody = 64 << 10  // Bytes of a web page searched for <title>
+)
+
+// tlsPorts speak TLS from the first byte.
+var tlsPorts = map[int]bool{443: true, 465: true, 636: true, 853: true, 993: true, 995: true, 8443: true, 8883: true}
+
+// httpPorts serve plain HTTP.
+var httpPorts = map[int]bool{80: true, 5000: true, 8000: true, 8008: true, 8080: true, 8123: true, 8888: true, 32400: true}
+
+var titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// grabBanner fills in the banner fields of an open port. It gives up as
+// soon as ctx is done.
+func grabBanner(ctx context.Context, ip string, p *models.Port) {
+	addr := net.JoinHostPort(ip, fmt.Sprint(p.Number))
+	p.Grabbed = time.Now()
+
+	switch {
+	case tlsPorts[p.Number]:
+		grabTLS(ctx, addr, p)
+	case httpPorts[p.Number]:
+		grabHTTP(ctx, "http://"+addr+"/", nil, p)
+	default:
+		grabGreeting(ctx, addr, p)
+	}
+}
+
+// grabGreeting reads the first line of protocols where the server speaks
+// first (SSH, FTP, SMTP, POP3, IMAP, telnet banners).
+func grabGreeting(ctx context.Context, addr string, p *models.Port) {
+	dialer := &net.Dialer{Timeout: bannerTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(bannerTimeout))
+
+	line, _ := bufio.NewReader(io.LimitReader(conn, 512)).ReadString('\n')
+	if line = cleanBanner(line); line == "" {
+		return
+	}
+	p.Banner = line
+	p.Product = productFromGreeting(line)
+}
+
+// grabTLS records the certificate and, for HTTPS, the web server details.
+func grabTLS(ctx context.Context, addr string, p *models.Port) {
+	// Home devices almost always use self-signed certificates; we only inspect them
+	conf := &tls.Config{InsecureSkipVerify: true}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: bannerTimeout}, Config: conf}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	conn.Close()
+
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		p.TLS = &models.TLSInfo{
+			Subject:  cert.Subject.String(),
+			Issuer:   cert.Issuer.String(),
+			NotAfter: cert.NotAfter,
+		}
+	}
+
+	switch p.Number {
+	case 443, 8443:
+		grabHTTP(ctx, "https://"+addr+"/", conf, p)
+	case 465, 993, 995:
+		// Implicit TLS mail protocols greet once the handshake is done
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		defer stop()
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(bannerTimeout))
+		line, _ := bufio.NewReader(io.LimitReader(conn, 512)).ReadString('\n')
+		if line = cleanBanner(line); line != "" {
+			p.Banner = line
+			p.Product = productFromGreeting(line)
+		}
+	}
+}
+
+// grabHTTP fetches the root page for the Server header and page title.
+func grabHTTP(ctx context.Context, url string, conf *tls.Config, p *models.Port) {
+	client := &http.Client{
+		Timeout:   bannerTimeout,
+		Transport: &http.Transport{TLSClientConfig: conf, DisableKeepAlives: true},
+		// Redirects usually point at a hostname we cannot resolve; the first answer is enough
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if server := resp.Header.Get("Server"); server != "" {
+		p.Product = cleanBanner(server)
+		p.Banner = "Server: " + p.Product
+	} else {
+		p.Banner = resp.Status
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, bannerMaxBody))
+	if m := titleRe.FindSubmatch(body); m != nil {
+		p.Title = cleanBanner(html.UnescapeString(strings.Join(strings.Fields(string(m[1])), " ")))
+	}
+}
+
+// productFromGreeting pulls the software name and version out of a greeting,
+// e.g. "SSH-2.0-OpenSSH_9.2p1 Debian-2" -> "OpenSSH_9.2p1 Debian-2" or
+// "220 (vsFTPd 3.0.3)" -> "vsFTPd 3.0.3".
+func productFromGreeting(line string) string {
+	if strings.HasPrefix(line, "SSH-") {
+		parts := strings.SplitN(line, "-", 3)
+		if len(parts) == 3 {
+			return parts[2]
+		}
+		return ""
+	}
+
+	// FTP/SMTP style: "220 host ESMTP Postfix (Debian)", "+OK Dovecot ready."
+	if i := strings.IndexByte(line, '('); i != -1 {
+		if j := strings.IndexByte(line[i:], ')'); j != -1 {
+			return line[i+1 : i+j]
+		}
+	}
+	return ""
+}
+
+// cleanBanner trims a banner and drops control characters so it renders safely.
+func cleanBanner(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	// Map left only valid UTF-8, so the cut lands between characters
+	return Truncate(strings.TrimSpace(s), 120)
+}
+
+// Truncate shortens s to at most max bytes without splitting a character.
+func Truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	end := max
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return s[:end]
+}
+
+// grabBanners fetches banners for newly opened ports and keeps recent ones
+// from the previous scan, so services are not re-queried every sweep. It
+// stops fetching once ctx is done.
+func (s *Scanner) grabBanners(ctx context.Context, ip string, ports []models.Port) {
+	s.mu.RLock()
+	var previous []models.Port
+	if dev := s.deviceAt(ip); dev != nil {
+		previous = dev.Ports
+	}
+	s.mu.RUnlock()
+
+	for i := range ports {
+		for _, old := range previous {
+			if old.Number == ports[i].Number && old.Protocol == ports[i].Protocol && time.Since(old.Grabbed) < bannerMaxAge {
+				ports[i].Banner, ports[i].Product, ports[i].Title = old.Banner, old.Product, old.Title
+				ports[i].TLS, ports[i].Grabbed = old.TLS, old.Grabbed
+			}
+		}
+		if !ports[i].Grabbed.IsZero() || ctx.Err() != nil {
+			continue
+		}
+		select {
+		case s.connSem <- struct{}{}:
+			grabBanner(ctx, ip, &ports[i])
+			<-s.connSem
+		case <-ctx.Done():
+		}
+	}
+}
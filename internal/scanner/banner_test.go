@@ -0,0 +1,22 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanBannerTruncatesOnRuneBoundary(t *testing.T) {
+	// 119 ASCII bytes, then a 3-byte character straddling byte 120
+	s := cleanBanner(strings.Repeat("a", 119) + "€uro\r\n")
+	if !utf8.ValidString(s) {
+		t.Fatalf("banner %q is not valid UTF-8", s)
+	}
+	if s != strings.Repeat("a", 119) {
+		t.Errorf("banner = %q, want the ASCII prefix only", s)
+	}
+
+	if s := cleanBanner("SSH-2.0-OpenSSH_9.2p1\r\n"); s != "SSH-2.0-OpenSSH_9.2p1" {
+		t.Errorf("banner = %q", s)
+	}
+}
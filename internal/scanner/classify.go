@@ -0,0 +1,345 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"homenet/internal/models"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fullConfidence is the score at which a type is considered certain.
+const fullConfidence = 100
+
+// ClassRule adds Weight points to Type when every condition it sets holds.
+// Text conditions are case-insensitive; a negative weight counts against
+// a type.
+type ClassRule struct {
+	Type        string `json:"type"`
+	Weight      int    `json:"weight"`
+	Vendor      string `json:"vendor,omitempty"`       // Substring of the manufacturer
+	Port        int    `json:"port,omitempty"`         // Open TCP port
+	MDNS        string `json:"mdns,omitempty"`         // Advertised service type, e.g. "_ipp._tcp"
+	UPnP        string `json:"upnp,omitempty"`         // Substring of the UPnP device type, model or a service
+	VendorClass string `json:"vendor_class,omitempty"` // Prefix of the DHCP vendor class
+	OS          string `json:"os,omitempty"`           // Substring of the OS guess
+	Hostname    string `json:"hostname,omitempty"`     // Regular expression matched against every known name
+
+	hostname *regexp.Regexp
+}
+
+// defaultRules are always loaded; a rules file adds to them.
+var defaultRules = []ClassRule{
+	// mDNS services
+	{Type: "Chromecast/Speaker", Weight: 80, MDNS: "_googlecast._tcp"},
+	{Type: "Apple Device", Weight: 50, MDNS: "_airplay._tcp"},
+	{Type: "Apple Device", Weight: 30, MDNS: "_raop._tcp"},
+	{Type: "Apple Device", Weight: 60, MDNS: "_companion-link._tcp"},
+	{Type: "Printer", Weight: 80, MDNS: "_ipp._tcp"},
+	{Type: "Printer", Weight: 80, MDNS: "_ipps._tcp"},
+	{Type: "Printer", Weight: 80, MDNS: "_printer._tcp"},
+	{Type: "Printer", Weight: 80, MDNS: "_pdl-datastream._tcp"},
+	{Type: "Speaker", Weight: 50, MDNS: "_spotify-connect._tcp"},
+	{Type: "Speaker", Weight: 90, MDNS: "_sonos._tcp"},
+	{Type: "Smart Home", Weight: 80, MDNS: "_hap._tcp"},
+	{Type: "Smart Home", Weight: 80, MDNS: "_homekit._tcp"},
+	{Type: "Smart Home", Weight: 90, MDNS: "_hue._tcp"},
+	{Type: "Computer/NAS", Weight: 50, MDNS: "_workstation._tcp"},
+	{Type: "Computer/NAS", Weight: 40, MDNS: "_smb._tcp"},
+	{Type: "Computer/NAS", Weight: 40, MDNS: "_afpovertcp._tcp"},
+	{Type: "Computer/NAS", Weight: 60, MDNS: "_adisk._tcp"},
+	{Type: "Web Server", Weight: 10, MDNS: "_http._tcp"},
+
+	// Open ports
+	{Type: "Printer", Weight: 60, Port: 9100},
+	{Type: "Printer", Weight: 40, Port: 631},
+	{Type: "Printer", Weight: 30, Port: 515},
+	{Type: "Computer/NAS", Weight: 60, Port: 3389},
+	{Type: "Computer/NAS", Weight: 30, Port: 445},
+	{Type: "Computer/NAS", Weight: 10, Port: 22},
+	{Type: "Chromecast/Speaker", Weight: 40, Port: 8009},
+	{Type: "Speaker", Weight: 60, Port: 1400},
+	{Type: "Phone", Weight: 80, Port: 62078},
+	{Type: "Router", Weight: 30, Port: 53},
+
+	// UPnP descriptions
+	{Type: "Router", Weight: 90, UPnP: "InternetGatewayDevice"},
+	{Type: "Router", Weight: 60, UPnP: "WANIPConnection"},
+	{Type: "TV/Media Player", Weight: 60, UPnP: "MediaRenderer"},
+	{Type: "TV/Media Player", Weight: 70, UPnP: "dial"},
+	{Type: "Media Server", Weight: 70, UPnP: "MediaServer"},
+	{Type: "Printer", Weight: 80, UPnP: "Printer"},
+	{Type: "Speaker", Weight: 90, UPnP: "ZonePlayer"},
+
+	// DHCP
+	{Type: "Phone", Weight: 60, VendorClass: "android-dhcp"},
+	{Type: "Computer/NAS", Weight: 50, VendorClass: "MSFT"},
+	{Type: "Phone", Weight: 60, OS: "iOS"},
+	{Type: "Phone", Weight: 50, OS: "Android"},
+	{Type: "Computer/NAS", Weight: 50, OS: "Windows"},
+	{Type: "Computer/NAS", Weight: 50, OS: "macOS"},
+	{Type: "Printer", Weight: 50, OS: "Printer"},
+
+	// Manufacturers
+	{Type: "Apple Device", Weight: 30, Vendor: "Apple"},
+	{Type: "Chromecast/Speaker", Weight: 20, Vendor: "Google"},
+	{Type: "Speaker", Weight: 30, Vendor: "Amazon"},
+	{Type: "Speaker", Weight: 80, Vendor: "Sonos"},
+	{Type: "TV/Media Player", Weight: 80, Vendor: "Roku"},
+	{Type: "Smart Home", Weight: 70, Vendor: "Signify"},
+	{Type: "Smart Home", Weight: 70, Vendor: "Philips Lighting"},
+	{Type: "Smart Home", Weight: 50, Vendor: "Espressif"},
+	{Type: "Smart Home", Weight: 60, Vendor: "Tuya"},
+	{Type: "Printer", Weight: 60, Vendor: "Brother"},
+	{Type: "Printer", Weight: 50, Vendor: "Epson"},
+	{Type: "Printer", Weight: 40, Vendor: "Canon"},
+	{Type: "Computer/NAS", Weight: 80, Vendor: "Synology"},
+	{Type: "Computer/NAS", Weight: 80, Vendor: "QNAP"},
+	{Type: "Computer/NAS", Weight: 40, Vendor: "Raspberry Pi"},
+	{Type: "Game Console", Weight: 80, Vendor: "Nintendo"},
+	{Type: "Game Console", Weight: 80, Vendor: "Sony Interactive"},
+	{Type: "Router", Weight: 60, Vendor: "AVM"},
+	{Type: "Router", Weight: 50, Vendor: "Ubiquiti"},
+	{Type: "Router", Weight: 30, Vendor: "Netgear"},
+	{Type: "Router", Weight: 20, Vendor: "TP-Link"},
+
+	// Host names
+	{Type: "Phone", Weight: 70, Hostname: `iphone`},
+	{Type: "Phone", Weight: 50, Hostname: `android|galaxy|pixel`},
+	{Type: "Tablet", Weight: 70, Hostname: `ipad|tablet`},
+	{Type: "Computer/NAS", Weight: 60, Hostname: `macbook|imac|mac-?mini`},
+	{Type: "Computer/NAS", Weight: 50, Hostname: `^(desktop|laptop)-`},
+	{Type: "Computer/NAS", Weight: 50, Hostname: `nas|diskstation`},
+	{Type: "Printer", Weight: 60, Hostname: `printer|^brn|^epson|^hp[0-9a-f]{6}`},
+	{Type: "Chromecast/Speaker", Weight: 80, Hostname: `chromecast`},
+	{Type: "Speaker", Weight: 40, Hostname: `echo|alexa|homepod`},
+	{Type: "TV/Media Player", Weight: 70, Hostname: `roku|apple-?tv|fire-?tv|shield|bravia|(^|[-_])tv\b`},
+	{Type: "Router", Weight: 60, Hostname: `router|gateway|fritz`},
+	{Type: "Game Console", Weight: 60, Hostname: `playstation|ps[45]|xbox|nintendo`},
+}
+
+// Classifier guesses a device's type from weighted rules.
+type Classifier struct {
+	Rules []ClassRule
+}
+
+// NewClassifier returns a classifier with the built-in rules.
+func NewClassifier() *Classifier {
+	c := &Classifier{}
+	c.add(defaultRules)
+	return c
+}
+
+// LoadClassifier adds the rules in path (a JSON array of ClassRule) to the
+// built-in ones. A missing file is not an error.
+func LoadClassifier(path string) (*Classifier, error) {
+	c := NewClassifier()
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	var rules []ClassRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	for i, r := range rules {
+		if r.Type == "" {
+			return c, fmt.Errorf("%s: rule %d has no type", path, i+1)
+		}
+		if r.Hostname != "" {
+			if _, err := regexp.Compile("(?i)" + r.Hostname); err != nil {
+				return c, fmt.Errorf("%s: rule %d: %v", path, i+1, err)
+			}
+		}
+	}
+	c.add(rules)
+	return c, nil
+}
+
+func (c *Classifier) add(rules []ClassRule) {
+	for _, r := range rules {
+		if r.Hostname != "" {
+			r.hostname = regexp.MustCompile("(?i)" + r.Hostname)
+		}
+		c.Rules = append(c.Rules, r)
+	}
+}
+
+// Types lists every type a rule can produce, sorted.
+func (c *Classifier) Types() []string {
+	var list []string
+	for _, r := range c.Rules {
+		if !contains(list, r.Type) {
+			list = append(list, r.Type)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Classify returns the best-scoring type for dev, a confidence from 0 to
+// 100 and the evidence behind it. Confidence grows with the winning score
+// up to fullConfidence and shrinks with the points other types collected.
+func (c *Classifier) Classify(dev *models.Device) (string, int, []string) {
+	scores := make(map[string]int)
+	evidence := make(map[string][]string)
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if what, ok := r.match(dev); ok {
+			scores[r.Type] += r.Weight
+			evidence[r.Type] = append(evidence[r.Type], fmt.Sprintf("%s (%+d)", what, r.Weight))
+		}
+	}
+
+	best, total := "", 0
+	for t, score := range scores {
+		if score <= 0 {
+			continue
+		}
+		total += score
+		if best == "" || score > scores[best] || (score == scores[best] && t < best) {
+			best = t
+		}
+	}
+	if best == "" {
+		return "Unknown", 0, nil
+	}
+
+	score := scores[best]
+	confidence := min(score, fullConfidence) * score / total
+	return best, confidence, evidence[best]
+}
+
+// match reports whether every condition of the rule holds and describes
+// what matched.
+func (r *ClassRule) match(dev *models.Device) (string, bool) {
+	var what []string
+	if r.Vendor != "" {
+		if !containsFold(dev.Manufacturer, r.Vendor) {
+			return "", false
+		}
+		what = append(what, "vendor "+dev.Manufacturer)
+	}
+	if r.Port != 0 {
+		found := false
+		for _, p := range dev.Ports {
+			found = found || p.Number == r.Port
+		}
+		if !found {
+			return "", false
+		}
+		what = append(what, "port "+strconv.Itoa(r.Port))
+	}
+	if r.MDNS != "" {
+		found := false
+		for _, svc := range dev.MDNSServices {
+			found = found || strings.EqualFold(svc.Service, r.MDNS)
+		}
+		if !found {
+			return "", false
+		}
+		what = append(what, "mDNS "+r.MDNS)
+	}
+	if r.UPnP != "" {
+		found := containsFold(dev.UPnPType, r.UPnP) || containsFold(dev.ModelName, r.UPnP)
+		for _, svc := range dev.UPnPServices {
+			found = found || containsFold(svc, r.UPnP)
+		}
+		if !found {
+			return "", false
+		}
+		what = append(what, "UPnP "+r.UPnP)
+	}
+	if r.VendorClass != "" {
+		if !strings.HasPrefix(strings.ToLower(dev.VendorClass), strings.ToLower(r.VendorClass)) {
+			return "", false
+		}
+		what = append(what, "DHCP vendor class "+dev.VendorClass)
+	}
+	if r.OS != "" {
+		if !containsFold(dev.OSGuess, r.OS) {
+			return "", false
+		}
+		what = append(what, "OS "+dev.OSGuess)
+	}
+	if r.hostname != nil {
+		name := ""
+		for _, n := range append([]string{dev.Hostname}, mapValues(dev.Names)...) {
+			if n != "" && r.hostname.MatchString(n) {
+				name = n
+				break
+			}
+		}
+		if name == "" {
+			return "", false
+		}
+		what = append(what, "hostname "+name)
+	}
+	if len(what) == 0 {
+		// A rule without conditions matches nothing
+		return "", false
+	}
+	return strings.Join(what, ", "), true
+}
+
+func containsFold(s string, substr string) bool {
+	return s != "" && strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func mapValues(m map[string]string) []string {
+	list := make([]string, 0, len(m))
+	for _, v := range m {
+		list = append(list, v)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// classify sets the type of dev from the rules unless the user chose one.
+// Callers hold s.mu.
+func (s *Scanner) classify(dev *models.Device) {
+	t, confidence, evidence := s.Classifier.Classify(dev)
+	dev.TypeConfidence, dev.TypeEvidence = confidence, evidence
+	if dev.TypeOverride != "" {
+		dev.DeviceType = dev.TypeOverride
+		return
+	}
+	dev.DeviceType = t
+}
+
+// classifyAll re-runs the classifier on every known device.
+func (s *Scanner) classifyAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, dev := range s.Devices {
+		s.classify(dev)
+	}
+}
+
+// SetClassifier replaces the type rules and reclassifies known devices.
+func (s *Scanner) SetClassifier(c *Classifier) {
+	s.mu.Lock()
+	s.Classifier = c
+	s.mu.Unlock()
+	s.classifyAll()
+}
+
+// SetTypeOverride pins the type of a device; an empty type returns it to
+// the classifier.
+func (s *Scanner) SetTypeOverride(id string, deviceType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dev := s.Devices[id]; dev != nil {
+		dev.TypeOverride = deviceType
+		s.classify(dev)
+	}
+}
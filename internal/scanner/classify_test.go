@@ -0,0 +1,155 @@
+package scanner
+
+import (
+	"homenet/internal/models"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	c := NewClassifier()
+	for _, tc := range []struct {
+		name       string
+		dev        models.Device
+		want       string
+		confidence int
+		evidence   []string
+	}{
+		{
+			name: "nothing known",
+			dev:  models.Device{Ports: []models.Port{{Number: 8080}}},
+			want: "Unknown",
+		},
+		{
+			name:       "printer by mDNS and port",
+			dev:        models.Device{MDNSServices: []models.MDNSService{{Service: "_IPP._tcp"}}, Ports: []models.Port{{Number: 9100}}},
+			want:       "Printer",
+			confidence: 100,
+			evidence:   []string{"mDNS _ipp._tcp (+80)", "port 9100 (+60)"},
+		},
+		{
+			name:       "phone outscores its vendor",
+			dev:        models.Device{Manufacturer: "Apple, Inc.", Hostname: "Johns-iPhone", Ports: []models.Port{{Number: 62078}}},
+			want:       "Phone",
+			confidence: 83, // 100 * 150 / (150 + 30)
+			evidence:   []string{"port 62078 (+80)", "hostname Johns-iPhone (+70)"},
+		},
+		{
+			name:       "weak evidence gives low confidence",
+			dev:        models.Device{Ports: []models.Port{{Number: 22}}},
+			want:       "Computer/NAS",
+			confidence: 10,
+			evidence:   []string{"port 22 (+10)"},
+		},
+		{
+			name:       "ties go to the first type by name",
+			dev:        models.Device{Ports: []models.Port{{Number: 9100}, {Number: 3389}}},
+			want:       "Computer/NAS",
+			confidence: 30, // 60 * 60 / 120
+			evidence:   []string{"port 3389 (+60)"},
+		},
+		{
+			name:       "hostname from any name source",
+			dev:        models.Device{Names: map[string]string{NameMDNS: "Living-Room-Chromecast"}},
+			want:       "Chromecast/Speaker",
+			confidence: 80,
+			evidence:   []string{"hostname Living-Room-Chromecast (+80)"},
+		},
+		{
+			name:       "vendor class is a prefix",
+			dev:        models.Device{VendorClass: "msft 5.0"},
+			want:       "Computer/NAS",
+			confidence: 50,
+			evidence:   []string{"DHCP vendor class msft 5.0 (+50)"},
+		},
+		{
+			name: "vendor class elsewhere in the string",
+			dev:  models.Device{VendorClass: "not MSFT"},
+			want: "Unknown",
+		},
+		{
+			name:       "UPnP service",
+			dev:        models.Device{UPnPServices: []string{"urn:schemas-upnp-org:service:WANIPConnection:1"}},
+			want:       "Router",
+			confidence: 60,
+			evidence:   []string{"UPnP WANIPConnection (+60)"},
+		},
+	} {
+		got, confidence, evidence := c.Classify(&tc.dev)
+		if got != tc.want || confidence != tc.confidence {
+			t.Errorf("%s: got %s (%d), want %s (%d)", tc.name, got, confidence, tc.want, tc.confidence)
+		}
+		if !reflect.DeepEqual(evidence, tc.evidence) {
+			t.Errorf("%s: evidence %q, want %q", tc.name, evidence, tc.evidence)
+		}
+	}
+}
+
+func TestLoadClassifier(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	writeFile(t, path, `[
+		{"type": "Printer", "weight": -200, "hostname": "^not-a-printer"},
+		{"type": "Weather Station", "weight": 90, "vendor": "Davis", "port": 80},
+		{"type": "Nothing", "weight": 100}
+	]`)
+	c, err := LoadClassifier(path)
+	if err != nil {
+		t.Fatalf("LoadClassifier: %v", err)
+	}
+	if got := len(c.Rules); got != len(defaultRules)+3 {
+		t.Errorf("got %d rules, want the %d built-in ones and 3 more", got, len(defaultRules))
+	}
+
+	for _, tc := range []struct {
+		name string
+		dev  models.Device
+		want string
+	}{
+		{"negative weight cancels a type", models.Device{Hostname: "not-a-printer", Ports: []models.Port{{Number: 9100}}}, "Unknown"},
+		{"every condition must hold", models.Device{Manufacturer: "Davis Instruments", Ports: []models.Port{{Number: 80}}}, "Weather Station"},
+		{"one condition is not enough", models.Device{Manufacturer: "Davis Instruments"}, "Unknown"},
+		{"built-in rules still apply", models.Device{Ports: []models.Port{{Number: 9100}}}, "Printer"},
+	} {
+		if got, _, _ := c.Classify(&tc.dev); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+	if types := c.Types(); !contains(types, "Weather Station") || !contains(types, "Printer") {
+		t.Errorf("Types() = %q, want the added type with the built-in ones", types)
+	}
+
+	if c, err := LoadClassifier(filepath.Join(dir, "missing.json")); err != nil || len(c.Rules) != len(defaultRules) {
+		t.Errorf("missing file: got %d rules, %v; want the built-in ones", len(c.Rules), err)
+	}
+	for _, tc := range []struct{ name, rules, want string }{
+		{"no type", `[{"weight": 10, "port": 80}]`, "rule 1 has no type"},
+		{"bad regexp", `[{"type": "Phone", "weight": 10}, {"type": "Phone", "weight": 10, "hostname": "("}]`, "rule 2"},
+		{"not JSON", `{"type": "Phone"}`, "rules.json"},
+	} {
+		writeFile(t, path, tc.rules)
+		if _, err := LoadClassifier(path); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestClassifyKeepsOverride(t *testing.T) {
+	s := &Scanner{Classifier: NewClassifier()}
+	dev := &models.Device{Ports: []models.Port{{Number: 9100}}, TypeOverride: "Label Printer"}
+	s.classify(dev)
+	if dev.DeviceType != "Label Printer" {
+		t.Errorf("got type %s, want the override", dev.DeviceType)
+	}
+	if dev.TypeConfidence != 60 || len(dev.TypeEvidence) != 1 {
+		t.Errorf("got confidence %d and evidence %q, want the classifier's guess kept alongside", dev.TypeConfidence, dev.TypeEvidence)
+	}
+
+	dev.TypeOverride = ""
+	s.classify(dev)
+	if dev.DeviceType != "Printer" {
+		t.Errorf("without override: got type %s, want Printer", dev.DeviceType)
+	}
+}
@@ -0,0 +1,352 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"homenet/internal/models"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// dhcpAckWait is how long a REQUEST waits for the server's answer before the
+// client is listed anyway. ACKs are usually sent straight to the client and
+// are not seen, but a NAK is always broadcast.
+const dhcpAckWait = 2 * time.Second
+
+// errSharedUnsupported is returned where a UDP port cannot be shared.
+var errSharedUnsupported = errors.New("sharing UDP ports not supported on this platform")
+
+// DHCPInfo is what one client request tells us about a device.
+type DHCPInfo struct {
+	MAC         string
+	IP          string // Requested or current address; empty for DISCOVER
+	MessageType string // e.g. "Discover", "Request"
+	Hostname    string // Option 12
+	VendorClass string // Option 60
+	Fingerprint string // Option 55, e.g. "1,3,6,15,31,33,43,44,46,47,119,121,249,252"
+	OS          string // Guess from the fingerprint and vendor class
+}
+
+// dhcpSignatures maps well-known parameter request lists to operating systems.
+var dhcpSignatures = map[string]string{
+	"1,3,6,15,31,33,43,44,46,47,119,121,249,252": "Windows",
+	"1,15,3,6,44,46,47,31,33,121,249,43":         "Windows 7",
+	"1,121,3,6,15,108,114,119,252,95,44,46":      "macOS",
+	"1,121,3,6,15,119,252,95,44,46":              "macOS",
+	"1,121,3,6,15,108,114,119,252":               "iOS",
+	"1,121,3,6,15,119,252":                       "iOS",
+	"1,3,6,15,26,28,51,58,59,43":                 "Android",
+	"1,3,6,15,26,28,51,58,59,43,114,108":         "Android",
+	"1,3,6,15,26,28,51,58,59,43,114":             "Android",
+	"1,28,2,3,15,6,119,12,44,47,26,121,42":       "Linux (dhclient)",
+	"1,3,6,12,15,28,42,43,119,121":               "Linux (systemd-networkd)",
+	"1,121,33,3,6,12,15,28,51,58,59,119":         "Linux (dhcpcd)",
+	"1,3,6,12,15,28,42":                          "Linux (udhcpc)",
+	"1,3,28,6":                                   "Embedded (lwIP)",
+	"1,3,6,15,28,33":                             "Embedded",
+	"1,3,6,15,44,46,47,31,33,121,249,252,43":     "Windows",
+	"1,33,3,6,15,28,51,58,59":                    "Android (legacy)",
+	"1,3,6,15,119,95,252,44,46,101":              "macOS (legacy)",
+	"1,3,6,15,119,78,79,95,252":                  "iOS (legacy)",
+	"1,3,6,15,112,113,78,79,95,252":              "macOS (legacy)",
+	"3,1,6,15,12,28,42,40,41":                    "Printer",
+	"1,3,6,12,15,17,23,28,29,31,33,40,41,42,119": "Linux",
+}
+
+// dhcpVendorPrefixes guess the OS from option 60 when the fingerprint is unknown.
+var dhcpVendorPrefixes = []struct{ prefix, os string }{
+	{"MSFT", "Windows"},
+	{"android-dhcp-", "Android"},
+	{"dhcpcd-", "Linux (dhcpcd)"},
+	{"udhcp", "Linux (udhcpc)"},
+	{"ubnt", "Ubiquiti"},
+	{"Cisco", "Cisco"},
+	{"HUAWEI", "Huawei"},
+}
+
+// guessDHCPOS names the OS behind a fingerprint and vendor class.
+func guessDHCPOS(fingerprint string, vendorClass string) string {
+	if os, ok := dhcpSignatures[fingerprint]; ok {
+		return os
+	}
+	for _, v := range dhcpVendorPrefixes {
+		if strings.HasPrefix(vendorClass, v.prefix) {
+			return v.os
+		}
+	}
+	return ""
+}
+
+// dhcpReply is a server's answer to a client's REQUEST.
+type dhcpReply struct {
+	MAC  string
+	XID  uint32
+	Type layers.DHCPMsgType
+	IP   string // Address assigned by an ACK
+}
+
+// pendingDHCP is a REQUEST waiting for the server's answer.
+type pendingDHCP struct {
+	info DHCPInfo
+	xid  uint32
+	at   time.Time
+}
+
+// parseDHCP extracts client details from a BOOTREQUEST.
+func parseDHCP(d *layers.DHCPv4) (DHCPInfo, bool) {
+	if d.Operation != layers.DHCPOpRequest || len(d.ClientHWAddr) != 6 {
+		return DHCPInfo{}, false
+	}
+	info := DHCPInfo{MAC: d.ClientHWAddr.String()}
+	if !d.ClientIP.IsUnspecified() && d.ClientIP != nil {
+		info.IP = d.ClientIP.String()
+	}
+
+	for _, opt := range d.Options {
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			if len(opt.Data) == 1 {
+				info.MessageType = layers.DHCPMsgType(opt.Data[0]).String()
+			}
+		case layers.DHCPOptHostname:
+			info.Hostname = cleanBanner(string(opt.Data))
+		case layers.DHCPOptClassID:
+			info.VendorClass = cleanBanner(string(opt.Data))
+		case layers.DHCPOptParamsRequest:
+			codes := make([]string, len(opt.Data))
+			for i, code := range opt.Data {
+				codes[i] = strconv.Itoa(int(code))
+			}
+			info.Fingerprint = strings.Join(codes, ",")
+		case layers.DHCPOptRequestIP:
+			if len(opt.Data) == 4 {
+				info.IP = net.IP(opt.Data).String()
+			}
+		}
+	}
+	info.OS = guessDHCPOS(info.Fingerprint, info.VendorClass)
+	return info, true
+}
+
+// parseDHCPReply extracts the outcome of a BOOTREPLY that is an ACK or a NAK.
+func parseDHCPReply(d *layers.DHCPv4) (dhcpReply, bool) {
+	if d.Operation != layers.DHCPOpReply || len(d.ClientHWAddr) != 6 {
+		return dhcpReply{}, false
+	}
+	r := dhcpReply{MAC: d.ClientHWAddr.String(), XID: d.Xid}
+	if !d.YourClientIP.IsUnspecified() && d.YourClientIP != nil {
+		r.IP = d.YourClientIP.String()
+	}
+	for _, opt := range d.Options {
+		if opt.Type == layers.DHCPOptMessageType && len(opt.Data) == 1 {
+			r.Type = layers.DHCPMsgType(opt.Data[0])
+		}
+	}
+	return r, r.Type == layers.DHCPMsgTypeAck || r.Type == layers.DHCPMsgTypeNak
+}
+
+// snoopDHCP listens for client broadcasts on UDP 67 until ctx is done.
+// Needs root (or CAP_NET_BIND_SERVICE) and cannot share the port with a
+// DHCP server on the same machine.
+func (s *Scanner) snoopDHCP(ctx context.Context) {
+	conn, err := net.ListenPacket("udp4", ":67")
+	if err != nil {
+		log.Printf("DHCP snooping unavailable: %v", err)
+		return
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		// Wake up regularly to list clients whose REQUEST went unanswered
+		conn.SetReadDeadline(time.Now().Add(dhcpAckWait / 2))
+		n, _, err := conn.ReadFrom(buf)
+		s.expireDHCP(time.Now())
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			if ctx.Err() == nil {
+				log.Printf("DHCP snooping stopped: %v", err)
+			}
+			return
+		}
+		var d layers.DHCPv4
+		if err := d.DecodeFromBytes(buf[:n], gopacket.NilDecodeFeedback); err != nil {
+			continue
+		}
+		if info, ok := parseDHCP(&d); ok {
+			s.handleDHCP(info, d.Xid, time.Now())
+		}
+	}
+}
+
+// watchDHCPReplies listens on UDP 68 for the ACKs and NAKs servers
+// broadcast until ctx is done. The port is shared with the host's own DHCP
+// client and the rogue DHCP check; where that is not possible, requests are
+// settled by expireDHCP alone.
+func (s *Scanner) watchDHCPReplies(ctx context.Context) {
+	conn, err := listenShared("udp4", ":68")
+	if err != nil {
+		log.Printf("DHCP reply watching unavailable: %v", err)
+		return
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("DHCP reply watching stopped: %v", err)
+			}
+			return
+		}
+		var d layers.DHCPv4
+		if err := d.DecodeFromBytes(buf[:n], gopacket.NilDecodeFeedback); err != nil {
+			continue
+		}
+		if r, ok := parseDHCPReply(&d); ok {
+			s.handleDHCPReply(r)
+		}
+	}
+}
+
+// ReadDHCPCapture returns the DHCP client requests in a pcap file, e.g. to
+// check what fingerprint a device sends.
+func ReadDHCPCapture(path string) ([]DHCPInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	source := gopacket.NewPacketSource(r, r.LinkType())
+	var list []DHCPInfo
+	for packet := range source.Packets() {
+		layer, ok := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4)
+		if !ok {
+			continue
+		}
+		if info, ok := parseDHCP(layer); ok {
+			list = append(list, info)
+		}
+	}
+	return list, nil
+}
+
+// handleDHCP records a client message. A REQUEST carries the address the
+// client is about to use, so a joining device is listed (and alerted on)
+// once the server agrees instead of at the next sweep. Other messages only
+// add details to a known device, except an INFORM from a client that
+// already has its address.
+func (s *Scanner) handleDHCP(info DHCPInfo, xid uint32, now time.Time) {
+	switch {
+	case info.MessageType == layers.DHCPMsgTypeRequest.String() && info.IP != "":
+		s.mu.Lock()
+		s.dhcpPending[normalizeMAC(info.MAC)] = pendingDHCP{info: info, xid: xid, at: now}
+		s.mu.Unlock()
+		info.IP = ""
+	case info.MessageType != layers.DHCPMsgTypeInform.String():
+		// A DISCOVER may name an address it would like, but has none yet
+		info.IP = ""
+	}
+	s.recordDHCP(info)
+}
+
+// handleDHCPReply settles a pending REQUEST: an ACK lists the client at the
+// address it was given, a NAK drops the request.
+func (s *Scanner) handleDHCPReply(r dhcpReply) {
+	mac := normalizeMAC(r.MAC)
+	s.mu.Lock()
+	p, ok := s.dhcpPending[mac]
+	if ok && p.xid == r.XID {
+		delete(s.dhcpPending, mac)
+	}
+	s.mu.Unlock()
+	if !ok || p.xid != r.XID || r.Type != layers.DHCPMsgTypeAck {
+		return
+	}
+	if r.IP != "" {
+		p.info.IP = r.IP
+	}
+	s.recordDHCP(p.info)
+}
+
+// expireDHCP lists the clients whose REQUEST got no NAK within dhcpAckWait.
+func (s *Scanner) expireDHCP(now time.Time) {
+	var due []DHCPInfo
+	s.mu.Lock()
+	for mac, p := range s.dhcpPending {
+		if now.Sub(p.at) >= dhcpAckWait {
+			due = append(due, p.info)
+			delete(s.dhcpPending, mac)
+		}
+	}
+	s.mu.Unlock()
+	for _, info := range due {
+		s.recordDHCP(info)
+	}
+}
+
+// recordDHCP applies a client's details, listing it at info.IP if set.
+func (s *Scanner) recordDHCP(info DHCPInfo) {
+	hostname := info.Hostname
+	if hostname == "" {
+		hostname = s.rotationHostname(info.IP, info.MAC)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var dev *models.Device
+	if info.IP != "" && s.inScope(info.IP) {
+		var isNew bool
+		dev, isNew = s.identify(info.IP, info.MAC, hostname)
+		if isNew && !s.firstScan {
+			label := info.IP
+			if info.Hostname != "" {
+				label = fmt.Sprintf("%s (%s)", info.IP, info.Hostname)
+			}
+			select {
+			case s.AlertChan <- fmt.Sprintf("NEW DEVICE: %s joined via DHCP", label):
+			default:
+			}
+		}
+		dev.LastSeen = time.Now()
+		s.setOnline(dev, true)
+	} else if dev = s.Devices[deviceID(info.MAC, "")]; dev == nil {
+		// DISCOVER from an unknown client: wait for its REQUEST
+		return
+	}
+
+	if info.Hostname != "" && contains(s.NameSources, NameDHCP) {
+		s.setName(dev, NameDHCP, info.Hostname)
+	}
+	if info.VendorClass != "" {
+		dev.VendorClass = info.VendorClass
+	}
+	if info.Fingerprint != "" {
+		dev.DHCPFingerprint = info.Fingerprint
+	}
+	if info.OS != "" {
+		dev.OSGuess, dev.OSSource = info.OS, NameDHCP
+	}
+}
@@ -0,0 +1,147 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	captureMAC         = "3c:22:fb:12:34:56"
+	captureFingerprint = "1,3,6,15,31,33,43,44,46,47,119,121,249,252"
+)
+
+func TestReadDHCPCapture(t *testing.T) {
+	list, err := ReadDHCPCapture(filepath.Join("testdata", "dhcp.pcap"))
+	if err != nil {
+		t.Fatalf("ReadDHCPCapture: %v", err)
+	}
+	// The server's ACK in the capture is not a client request
+	if len(list) != 2 {
+		t.Fatalf("got %d requests, want 2: %+v", len(list), list)
+	}
+
+	want := []DHCPInfo{
+		{MAC: captureMAC, MessageType: "Discover"},
+		{MAC: captureMAC, MessageType: "Request", IP: "192.168.1.57"},
+	}
+	for i, info := range list {
+		want[i].Hostname = "DESKTOP-7Q2K"
+		want[i].VendorClass = "MSFT 5.0"
+		want[i].Fingerprint = captureFingerprint
+		want[i].OS = "Windows"
+		if info != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, info, want[i])
+		}
+	}
+}
+
+func newDHCPScanner(t *testing.T) *Scanner {
+	t.Helper()
+	s, err := NewScanner([]string{"192.168.1.0/24"}, nil, 0, filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	s.ARPWatch = false
+	s.NameSources = []string{NameDHCP}
+	return s
+}
+
+func dhcpRequest() DHCPInfo {
+	return DHCPInfo{
+		MAC:         captureMAC,
+		IP:          "192.168.1.57",
+		MessageType: "Request",
+		Hostname:    "DESKTOP-7Q2K",
+		Fingerprint: captureFingerprint,
+		OS:          "Windows",
+	}
+}
+
+func TestDHCPRequestWaitsForAck(t *testing.T) {
+	s := newDHCPScanner(t)
+	now := time.Now()
+
+	s.handleDHCP(dhcpRequest(), 7, now)
+	if s.deviceAt("192.168.1.57") != nil {
+		t.Fatal("device listed before the server answered")
+	}
+
+	// An ACK for another transaction changes nothing
+	s.handleDHCPReply(dhcpReply{MAC: captureMAC, XID: 8, Type: layers.DHCPMsgTypeAck, IP: "192.168.1.57"})
+	if s.deviceAt("192.168.1.57") != nil {
+		t.Fatal("device listed on another transaction's ACK")
+	}
+
+	s.handleDHCPReply(dhcpReply{MAC: captureMAC, XID: 7, Type: layers.DHCPMsgTypeAck, IP: "192.168.1.57"})
+	dev := s.deviceAt("192.168.1.57")
+	if dev == nil || !dev.IsOnline {
+		t.Fatalf("device after ACK = %+v, want online", dev)
+	}
+	if dev.Hostname != "DESKTOP-7Q2K" || dev.DHCPFingerprint != captureFingerprint || dev.OSGuess != "Windows" {
+		t.Errorf("device details = %q, %q, %q", dev.Hostname, dev.DHCPFingerprint, dev.OSGuess)
+	}
+	if len(s.dhcpPending) != 0 {
+		t.Errorf("%d requests still pending", len(s.dhcpPending))
+	}
+}
+
+func TestDHCPRequestNak(t *testing.T) {
+	s := newDHCPScanner(t)
+	now := time.Now()
+
+	s.handleDHCP(dhcpRequest(), 7, now)
+	s.handleDHCPReply(dhcpReply{MAC: captureMAC, XID: 7, Type: layers.DHCPMsgTypeNak})
+	s.expireDHCP(now.Add(time.Hour))
+	if dev := s.deviceAt("192.168.1.57"); dev != nil {
+		t.Errorf("refused request listed %+v", dev)
+	}
+}
+
+func TestDHCPRequestUnanswered(t *testing.T) {
+	s := newDHCPScanner(t)
+	now := time.Now()
+
+	s.handleDHCP(dhcpRequest(), 7, now)
+	s.expireDHCP(now.Add(dhcpAckWait / 2))
+	if s.deviceAt("192.168.1.57") != nil {
+		t.Fatal("device listed before the wait was over")
+	}
+	// The ACK went straight to the client; no NAK means the server agreed
+	s.expireDHCP(now.Add(dhcpAckWait))
+	if dev := s.deviceAt("192.168.1.57"); dev == nil || !dev.IsOnline {
+		t.Errorf("device after the wait = %+v, want online", dev)
+	}
+}
+
+func TestDHCPDiscoverDoesNotList(t *testing.T) {
+	s := newDHCPScanner(t)
+	info := dhcpRequest()
+	info.MessageType = "Discover"
+
+	s.handleDHCP(info, 7, time.Now())
+	s.expireDHCP(time.Now().Add(time.Hour))
+	if dev := s.deviceAt("192.168.1.57"); dev != nil {
+		t.Errorf("DISCOVER listed %+v", dev)
+	}
+}
+
+func TestDHCPHostnameNeedsNameSource(t *testing.T) {
+	s := newDHCPScanner(t)
+	s.NameSources = []string{"dns", "mdns"}
+
+	s.recordDHCP(dhcpRequest())
+	dev := s.deviceAt("192.168.1.57")
+	if dev == nil {
+		t.Fatal("device not listed")
+	}
+	if dev.Hostname != "" || dev.Names[NameDHCP] != "" {
+		t.Errorf("hostname %q, names %v; want none with dhcp left out of the name sources", dev.Hostname, dev.Names)
+	}
+	// The rest of the request is still used
+	if dev.DHCPFingerprint != captureFingerprint || dev.OSGuess != "Windows" {
+		t.Errorf("fingerprint %q, OS %q", dev.DHCPFingerprint, dev.OSGuess)
+	}
+}
@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"homenet/internal/models"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// dhcpOfferWait is how long offers are collected after a DISCOVER.
+const dhcpOfferWait = 3 * time.Second
+
+// dhcpProbeRequest builds a broadcast DHCPDISCOVER from a random, locally
+// administered MAC so no real client's lease is touched.
+func dhcpProbeRequest() ([]byte, uint32, error) {
+	id := make([]byte, 10)
+	if _, err := rand.Read(id); err != nil {
+		return nil, 0, err
+	}
+	mac := net.HardwareAddr(id[:6])
+	mac[0] = mac[0]&0xfc | 0x02 // Unicast, locally administered
+	xid := binary.BigEndian.Uint32(id[6:])
+
+	d := &layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          xid,
+		Flags:        0x8000, // Ask servers to broadcast the offer
+		ClientHWAddr: mac,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}),
+			layers.NewDHCPOption(layers.DHCPOptParamsRequest, []byte{1, 3, 6}),
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := d.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), xid, nil
+}
+
+// discoverDHCPServers broadcasts a DHCPDISCOVER and returns every server
+// that made an offer within wait, or before ctx is done. No REQUEST follows,
+// so no lease is taken. Binding the client port needs root.
+func discoverDHCPServers(ctx context.Context, wait time.Duration) ([]models.DHCPServer, error) {
+	conn, err := listenShared("udp4", ":68")
+	if errors.Is(err, errSharedUnsupported) {
+		conn, err = net.ListenPacket("udp4", ":68")
+	}
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	pkt, xid, err := dhcpProbeRequest()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(pkt, &net.UDPAddr{IP: net.IPv4bcast, Port: 67}); err != nil {
+		return nil, err
+	}
+
+	servers := make(map[string]models.DHCPServer)
+	conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Read deadline reached or cancelled
+			break
+		}
+		var from net.IP
+		if addr, ok := peer.(*net.UDPAddr); ok {
+			from = addr.IP
+		}
+		if offer, ok := parseDHCPOffer(buf[:n], from, xid, time.Now()); ok {
+			servers[offer.IP] = offer
+		}
+	}
+
+	list := make([]models.DHCPServer, 0, len(servers))
+	for _, srv := range servers {
+		list = append(list, srv)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].IP < list[j].IP })
+	return list, nil
+}
+
+// parseDHCPOffer reads an OFFER answering our DISCOVER with transaction xid,
+// sent from the address from. The server identifier option, where present,
+// names the server rather than the address the packet came from (a relay).
+func parseDHCPOffer(data []byte, from net.IP, xid uint32, now time.Time) (models.DHCPServer, bool) {
+	var d layers.DHCPv4
+	if err := d.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil || d.Operation != layers.DHCPOpReply || d.Xid != xid {
+		return models.DHCPServer{}, false
+	}
+	offer := models.DHCPServer{OfferedIP: d.YourClientIP.String(), LastOffer: now}
+	if from != nil {
+		offer.IP = from.String()
+	}
+	isOffer := false
+	for _, opt := range d.Options {
+		switch opt.Type {
+		case layers.DHCPOptMessageType:
+			isOffer = len(opt.Data) == 1 && layers.DHCPMsgType(opt.Data[0]) == layers.DHCPMsgTypeOffer
+		case layers.DHCPOptServerID:
+			if len(opt.Data) == 4 {
+				offer.IP = net.IP(opt.Data).String()
+			}
+		case layers.DHCPOptRouter:
+			if len(opt.Data) >= 4 {
+				offer.Router = net.IP(opt.Data[:4]).String()
+			}
+		case layers.DHCPOptDNS:
+			for i := 0; i+4 <= len(opt.Data); i += 4 {
+				offer.DNS = append(offer.DNS, net.IP(opt.Data[i:i+4]).String())
+			}
+		}
+	}
+	return offer, isOffer && offer.IP != ""
+}
+
+// watchDHCPServers looks for rogue DHCP servers right away and then every
+// DHCPCheck until ctx is done. It runs apart from the scans, so waiting for
+// offers never holds one up. Failures are logged once.
+func (s *Scanner) watchDHCPServers(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failed := false
+	for {
+		if err := s.checkDHCPServers(ctx); err != nil && !failed {
+			log.Printf("Rogue DHCP check unavailable: %v", err)
+			failed = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDHCPServers runs a DISCOVER and alerts on offers from untrusted
+// servers. It returns nil if ctx was cancelled.
+func (s *Scanner) checkDHCPServers(ctx context.Context) error {
+	// The gateways are trusted by default
+	s.updateGateways()
+
+	offers, err := discoverDHCPServers(ctx, dhcpOfferWait)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, offer := range offers {
+		if dev := s.deviceAt(offer.IP); dev != nil {
+			offer.MAC = dev.MAC
+		}
+		offer.Trusted = s.trustedDHCP(offer)
+		s.dhcpServers[offer.IP] = offer
+		if !offer.Trusted {
+			who := offer.IP
+			if offer.MAC != "" {
+				who = fmt.Sprintf("%s (%s)", offer.IP, offer.MAC)
+			}
+			var macs []string
+			if offer.MAC != "" {
+				macs = []string{strings.ToLower(offer.MAC)}
+			}
+			s.raise(models.AlertRogueDHCP, offer.IP, macs,
+				fmt.Sprintf("Untrusted DHCP server %s offered %s with router %s", who, offer.OfferedIP, offer.Router), time.Now())
+		}
+	}
+	return nil
+}
+
+// trustedDHCP reports whether a server is on the trusted list (by IP or
+// MAC). With no list, the default gateways are trusted. Callers hold s.mu.
+func (s *Scanner) trustedDHCP(srv models.DHCPServer) bool {
+	if len(s.TrustedDHCP) == 0 {
+		_, ok := s.bindings.gateways[srv.IP]
+		return ok
+	}
+	for _, t := range s.TrustedDHCP {
+		if t == srv.IP {
+			return true
+		}
+		if mac := normalizeMAC(t); len(mac) == 12 && srv.MAC != "" && mac == normalizeMAC(srv.MAC) {
+			return true
+		}
+	}
+	return false
+}
+
+// DHCPServers returns the servers that answered the last checks.
+func (s *Scanner) DHCPServers() []models.DHCPServer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]models.DHCPServer, 0, len(s.dhcpServers))
+	for _, srv := range s.dhcpServers {
+		list = append(list, srv)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].IP < list[j].IP })
+	return list
+}
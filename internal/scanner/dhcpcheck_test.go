@@ -0,0 +1,112 @@
+package scanner
+
+import (
+	"homenet/internal/models"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// dhcpOffer builds a server's answer to transaction xid.
+func dhcpOffer(t *testing.T, op layers.DHCPOp, xid uint32, msgType layers.DHCPMsgType, opts ...layers.DHCPOption) []byte {
+	t.Helper()
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	d := &layers.DHCPv4{
+		Operation:    op,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          xid,
+		YourClientIP: net.ParseIP("192.168.1.150").To4(),
+		ClientHWAddr: mac,
+		Options:      append(layers.DHCPOptions{layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(msgType)})}, opts...),
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := d.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseDHCPOffer(t *testing.T) {
+	const xid = 0x1234abcd
+	now := time.Now()
+	from := net.ParseIP("192.168.1.1")
+	serverID := layers.NewDHCPOption(layers.DHCPOptServerID, []byte{192, 168, 1, 2})
+	router := layers.NewDHCPOption(layers.DHCPOptRouter, []byte{192, 168, 1, 1})
+	dns := layers.NewDHCPOption(layers.DHCPOptDNS, []byte{192, 168, 1, 1, 9, 9, 9, 9, 1})
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		from net.IP
+		want models.DHCPServer
+		ok   bool
+	}{
+		{
+			name: "offer",
+			data: dhcpOffer(t, layers.DHCPOpReply, xid, layers.DHCPMsgTypeOffer, router, dns),
+			from: from,
+			want: models.DHCPServer{IP: "192.168.1.1", OfferedIP: "192.168.1.150", Router: "192.168.1.1", DNS: []string{"192.168.1.1", "9.9.9.9"}, LastOffer: now},
+			ok:   true,
+		},
+		{
+			name: "relayed offer names its server",
+			data: dhcpOffer(t, layers.DHCPOpReply, xid, layers.DHCPMsgTypeOffer, serverID),
+			from: from,
+			want: models.DHCPServer{IP: "192.168.1.2", OfferedIP: "192.168.1.150", LastOffer: now},
+			ok:   true,
+		},
+		{
+			name: "server ID without a source address",
+			data: dhcpOffer(t, layers.DHCPOpReply, xid, layers.DHCPMsgTypeOffer, serverID),
+			want: models.DHCPServer{IP: "192.168.1.2", OfferedIP: "192.168.1.150", LastOffer: now},
+			ok:   true,
+		},
+		{name: "no server address", data: dhcpOffer(t, layers.DHCPOpReply, xid, layers.DHCPMsgTypeOffer)},
+		{name: "other transaction", data: dhcpOffer(t, layers.DHCPOpReply, xid+1, layers.DHCPMsgTypeOffer), from: from},
+		{name: "ack", data: dhcpOffer(t, layers.DHCPOpReply, xid, layers.DHCPMsgTypeAck), from: from},
+		{name: "another client's discover", data: dhcpOffer(t, layers.DHCPOpRequest, xid, layers.DHCPMsgTypeDiscover), from: from},
+		{name: "truncated", data: dhcpOffer(t, layers.DHCPOpReply, xid, layers.DHCPMsgTypeOffer)[:100], from: from},
+	} {
+		offer, ok := parseDHCPOffer(tc.data, tc.from, xid, now)
+		if ok != tc.ok {
+			t.Errorf("%s: ok = %v, want %v", tc.name, ok, tc.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(offer, tc.want) {
+			t.Errorf("%s: offer = %+v, want %+v", tc.name, offer, tc.want)
+		}
+	}
+}
+
+func TestTrustedDHCP(t *testing.T) {
+	s := newDHCPScanner(t)
+	s.bindings.gateways["192.168.1.1"] = &gatewayBinding{}
+	router := models.DHCPServer{IP: "192.168.1.1", MAC: "00:11:22:33:44:01"}
+	pihole := models.DHCPServer{IP: "192.168.1.2", MAC: "00:11:22:33:44:02"}
+	rogue := models.DHCPServer{IP: "192.168.1.3", MAC: "00:11:22:33:44:03"}
+
+	for _, tc := range []struct {
+		name    string
+		trusted []string
+		srv     models.DHCPServer
+		want    bool
+	}{
+		{"gateway by default", nil, router, true},
+		{"other server by default", nil, pihole, false},
+		{"listed IP", []string{"192.168.1.2"}, pihole, true},
+		{"listed MAC", []string{"00-11-22-33-44-02"}, pihole, true},
+		{"listed MAC, server MAC unknown", []string{"00:11:22:33:44:02"}, models.DHCPServer{IP: "192.168.1.2"}, false},
+		{"gateway not listed", []string{"192.168.1.2"}, router, false},
+		{"rogue", []string{"192.168.1.2", "00:11:22:33:44:01"}, rogue, false},
+	} {
+		s.TrustedDHCP = tc.trusted
+		if got := s.trustedDHCP(tc.srv); got != tc.want {
+			t.Errorf("%s: trusted = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
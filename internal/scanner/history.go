@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"encoding/json"
+	"homenet/internal/models"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxTransitions     = 1000 // Per device
+	defaultHistoryDays = 30
+	timelineSlots      = 48 // Half hours in the 24h timeline
+)
+
+// History stores online/offline transitions per device ID, bounded by age
+// and count, and persists them next to devices.json.
+type History struct {
+	mu          sync.Mutex
+	path        string
+	retention   time.Duration
+	Transitions map[string][]models.Transition
+}
+
+// LoadHistory reads the history file, if any. An empty path keeps history in memory.
+func LoadHistory(path string, days int) *History {
+	if days <= 0 {
+		days = defaultHistoryDays
+	}
+	h := &History{
+		path:        path,
+		retention:   time.Duration(days) * 24 * time.Hour,
+		Transitions: make(map[string][]models.Transition),
+	}
+	if path == "" {
+		return h
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// File likely doesn't exist yet, which is fine
+		return h
+	}
+	if err := json.Unmarshal(data, &h.Transitions); err != nil {
+		log.Printf("Error loading presence history: %v", err)
+	}
+	return h
+}
+
+// Record appends a transition if it changes the device's state.
+func (h *History) Record(id string, online bool, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := h.Transitions[id]
+	if n := len(list); n > 0 && list[n-1].Online == online {
+		return
+	}
+	list = append(list, models.Transition{At: at, Online: online})
+	h.Transitions[id] = h.prune(list, at)
+}
+
+// Online reports the state of the last recorded transition.
+func (h *History) Online(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := h.Transitions[id]
+	return len(list) > 0 && list[len(list)-1].Online
+}
+
+// Rename moves history when a device is re-keyed. If the new ID already has
+// history the two are interleaved by time, dropping transitions that repeat
+// the state before them.
+func (h *History) Rename(from string, to string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list, ok := h.Transitions[from]
+	if !ok {
+		return
+	}
+	delete(h.Transitions, from)
+	merged := append(append([]models.Transition(nil), h.Transitions[to]...), list...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].At.Before(merged[j].At) })
+
+	kept := merged[:0]
+	for _, t := range merged {
+		if n := len(kept); n > 0 && kept[n-1].Online == t.Online {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	if n := len(kept); n > 0 {
+		kept = h.prune(kept, kept[n-1].At)
+	}
+	h.Transitions[to] = kept
+}
+
+// prune drops transitions beyond the retention period or count, always
+// keeping the latest one so the current state survives.
+func (h *History) prune(list []models.Transition, now time.Time) []models.Transition {
+	cutoff := now.Add(-h.retention)
+	start := 0
+	for start < len(list)-1 && list[start].At.Before(cutoff) {
+		start++
+	}
+	if len(list)-start > maxTransitions {
+		start = len(list) - maxTransitions
+	}
+	return list[start:]
+}
+
+// Save writes the history file atomically.
+func (h *History) Save() {
+	if h.path == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := json.Marshal(h.Transitions)
+	if err != nil {
+		log.Printf("Error marshaling presence history: %v", err)
+		return
+	}
+	tmpFile := h.path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		log.Printf("Error writing presence history: %v", err)
+		return
+	}
+	if runtime.GOOS == "windows" {
+		_ = os.Remove(h.path)
+	}
+	if err := os.Rename(tmpFile, h.path); err != nil {
+		log.Printf("Error renaming presence history: %v", err)
+	}
+}
+
+// Summary computes uptime, sessions and the 24h timeline for a device.
+func (h *History) Summary(id string, now time.Time) models.PresenceSummary {
+	h.mu.Lock()
+	list := append([]models.Transition(nil), h.Transitions[id]...)
+	h.mu.Unlock()
+
+	var sum models.PresenceSummary
+	if len(list) == 0 {
+		return sum
+	}
+	sum.FirstSeen = list[0].At
+	sum.Uptime24h = uptime(list, now.Add(-24*time.Hour), now)
+	sum.Uptime7d = uptime(list, now.Add(-7*24*time.Hour), now)
+
+	for i := len(list) - 1; i >= 0; i-- {
+		if !list[i].Online {
+			continue
+		}
+		session := models.Session{Start: list[i].At, End: now, Ongoing: true}
+		if i+1 < len(list) {
+			session.End, session.Ongoing = list[i+1].At, false
+		}
+		sum.Sessions = append(sum.Sessions, session)
+	}
+
+	slot := 24 * time.Hour / timelineSlots
+	start := now.Add(-24 * time.Hour)
+	sum.Last24h = make([]bool, timelineSlots)
+	for i := range sum.Last24h {
+		sum.Last24h[i] = onlineDuring(list, start.Add(time.Duration(i)*slot), start.Add(time.Duration(i+1)*slot))
+	}
+	return sum
+}
+
+// uptime is the percentage of [from, to] spent online, counting only time
+// since the first transition.
+func uptime(list []models.Transition, from time.Time, to time.Time) float64 {
+	if list[0].At.After(from) {
+		from = list[0].At
+	}
+	total := to.Sub(from)
+	if total <= 0 {
+		return 0
+	}
+
+	var online time.Duration
+	for i, t := range list {
+		if !t.Online {
+			continue
+		}
+		end := to
+		if i+1 < len(list) {
+			end = list[i+1].At
+		}
+		start := t.At
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			online += end.Sub(start)
+		}
+	}
+	return float64(online) / float64(total) * 100
+}
+
+// onlineDuring reports whether any online period overlaps [from, to).
+func onlineDuring(list []models.Transition, from time.Time, to time.Time) bool {
+	for i, t := range list {
+		if !t.Online || !t.At.Before(to) {
+			continue
+		}
+		if i+1 == len(list) || list[i+1].At.After(from) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// pingTimeout is how long we wait for echo replies after the last request.
+const pingTimeout = time.Second
+
+// listenICMP opens an unprivileged datagram ICMP socket where the OS allows it
+// (Linux with net.ipv4.ping_group_range, macOS), and a raw socket otherwise.
+func listenICMP() (*icmp.PacketConn, bool, error) {
+	if conn, err := icmp.ListenPacket("udp4", "0.0.0.0"); err == nil {
+		return conn, true, nil
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	return conn, false, err
+}
+
+// pingSweep sends one ICMP echo request to every target and returns the
+// round-trip time of each host that replied. It stops sending and waiting
+// as soon as ctx is done.
+func pingSweep(ctx context.Context, targets []string, timeout time.Duration) (map[string]time.Duration, error) {
+	conn, datagram, err := listenICMP()
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	var mu sync.Mutex
+	sent := make(map[string]time.Time, len(targets))
+	seqs := make(map[string]int, len(targets))
+	rtts := make(map[string]time.Duration)
+	id := os.Getpid() & 0xffff
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				// Read deadline reached or socket closed
+				return
+			}
+			received := time.Now()
+			seq, ok := parseEchoReply(buf[:n], id, datagram)
+			if !ok {
+				continue
+			}
+
+			var ip string
+			switch addr := peer.(type) {
+			case *net.UDPAddr:
+				ip = addr.IP.String()
+			case *net.IPAddr:
+				ip = addr.IP.String()
+			}
+
+			mu.Lock()
+			if start, ok := sent[ip]; ok && seqs[ip] == seq {
+				if _, seen := rtts[ip]; !seen {
+					rtts[ip] = received.Sub(start)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	for i, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		ip := net.ParseIP(target)
+		if ip == nil {
+			continue
+		}
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Code: 0,
+			Body: &icmp.Echo{ID: id, Seq: i & 0xffff, Data: []byte("homenet")},
+		}
+		data, err := msg.Marshal(nil)
+		if err != nil {
+			continue
+		}
+
+		var dst net.Addr = &net.IPAddr{IP: ip}
+		if datagram {
+			dst = &net.UDPAddr{IP: ip}
+		}
+
+		mu.Lock()
+		sent[target] = time.Now()
+		seqs[target] = i & 0xffff
+		mu.Unlock()
+		conn.WriteTo(data, dst)
+		time.Sleep(time.Millisecond)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	return rtts, nil
+}
+
+// parseEchoReply returns the sequence number of an echo reply meant for us.
+// On raw sockets every process sees every reply, so the ID must be ours; on
+// datagram sockets the kernel rewrites the ID and only delivers our replies.
+func parseEchoReply(data []byte, id int, datagram bool) (int, bool) {
+	msg, err := icmp.ParseMessage(1, data) // 1 = ICMPv4
+	if err != nil || msg.Type != ipv4.ICMPTypeEchoReply {
+		return 0, false
+	}
+	echo, ok := msg.Body.(*icmp.Echo)
+	if !ok || (!datagram && echo.ID != id) {
+		return 0, false
+	}
+	return echo.Seq, true
+}
@@ -0,0 +1,46 @@
+package scanner
+
+import (
+	"testing"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func echoPacket(t *testing.T, typ ipv4.ICMPType, id, seq int) []byte {
+	t.Helper()
+	msg := icmp.Message{Type: typ, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("homenet")}}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseEchoReply(t *testing.T) {
+	const id = 0x1234
+	unreachable, err := (&icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Body: &icmp.DstUnreach{Data: make([]byte, 28)}}).Marshal(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		datagram bool
+		ok       bool
+		seq      int
+	}{
+		{"our reply", echoPacket(t, ipv4.ICMPTypeEchoReply, id, 7), false, true, 7},
+		{"another process's reply", echoPacket(t, ipv4.ICMPTypeEchoReply, id+1, 7), false, false, 0},
+		{"rewritten ID on a datagram socket", echoPacket(t, ipv4.ICMPTypeEchoReply, 0x9999, 7), true, true, 7},
+		{"echo request", echoPacket(t, ipv4.ICMPTypeEcho, id, 7), false, false, 0},
+		{"unreachable", unreachable, false, false, 0},
+		{"truncated", []byte{0, 0}, false, false, 0},
+	} {
+		seq, ok := parseEchoReply(tc.data, id, tc.datagram)
+		if ok != tc.ok || seq != tc.seq {
+			t.Errorf("%s: got seq %d, %v; want %d, %v", tc.name, seq, ok, tc.seq, tc.ok)
+		}
+	}
+}
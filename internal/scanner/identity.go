@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"homenet/internal/models"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxIPHistory bounds how many past addresses are kept per device.
+const maxIPHistory = 20
+
+// deviceID derives a stable identifier: the MAC address where we know it,
+// otherwise the IP (for hosts behind a router, whose MAC we never see).
+func deviceID(mac string, ip string) string {
+	if hex := normalizeMAC(mac); len(hex) == 12 && hex != "000000000000" {
+		return "mac-" + strings.ToLower(hex)
+	}
+	return "ip-" + ip
+}
+
+// isRandomizedMAC reports whether a MAC is locally administered, as used by
+// phones and laptops that pick a private address per network.
+func isRandomizedMAC(mac string) bool {
+	hex := normalizeMAC(mac)
+	return len(hex) == 12 && isLocallyAdministered(hex)
+}
+
+// deviceAt returns the device currently holding ip. Callers hold s.mu.
+func (s *Scanner) deviceAt(ip string) *models.Device {
+	if id, ok := s.byIP[ip]; ok {
+		return s.Devices[id]
+	}
+	return nil
+}
+
+// identify finds or creates the device answering at ip with the given MAC
+// (empty if unknown), moving it to ip if its address changed. hostname is
+// the host's name if already known (see rotationHostname); it lets a phone
+// that rotated its private MAC keep its identity. isNew is true only for
+// devices never seen before. Callers hold s.mu.
+func (s *Scanner) identify(ip string, mac string, hostname string) (dev *models.Device, isNew bool) {
+	id := deviceID(mac, ip)
+	dev = s.Devices[id]
+
+	if dev == nil && mac != "" && !strings.HasPrefix(id, "ip-") {
+		if current := s.deviceAt(ip); current != nil && strings.HasPrefix(current.ID, "ip-") {
+			// Known only by address until now; re-key it under its MAC
+			s.rekey(current, id)
+			dev = current
+		} else if isRandomizedMAC(mac) {
+			if dev = s.matchRandomized(hostname, mac); dev != nil {
+				s.rekey(dev, id)
+			}
+		}
+	}
+	if dev == nil && mac == "" {
+		dev = s.deviceAt(ip)
+	}
+
+	if dev == nil {
+		// Names are looked up by updateNames once the device is registered
+		dev = &models.Device{ID: id, IP: ip, FirstSeen: time.Now()}
+		s.Devices[id] = dev
+		isNew = true
+	}
+
+	if mac != "" && dev.MAC != mac {
+		if dev.MAC != "" && !contains(dev.PreviousMACs, dev.MAC) {
+			dev.PreviousMACs = append(dev.PreviousMACs, dev.MAC)
+		}
+		dev.MAC = mac
+		dev.Manufacturer = s.Vendors.Lookup(mac)
+	}
+	s.moveIP(dev, ip)
+	return dev, isNew
+}
+
+// rotationHostname resolves the name of a host answering from a randomized
+// MAC we have not seen before, for identify to match against. Called without
+// s.mu, as the PTR lookup can be slow; returns "" when no lookup is needed.
+func (s *Scanner) rotationHostname(ip string, mac string) string {
+	if ip == "" || !isRandomizedMAC(mac) {
+		return ""
+	}
+	s.mu.RLock()
+	_, known := s.Devices[deviceID(mac, ip)]
+	s.mu.RUnlock()
+	if known {
+		return ""
+	}
+	names, _ := net.LookupAddr(ip)
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// rekey files dev under a new ID, e.g. once its MAC is known or after it
+// rotated its private MAC. Callers hold s.mu.
+func (s *Scanner) rekey(dev *models.Device, id string) {
+	delete(s.Devices, dev.ID)
+	s.History.Rename(dev.ID, id)
+	if checked, ok := s.namesChecked[dev.ID]; ok {
+		delete(s.namesChecked, dev.ID)
+		s.namesChecked[id] = checked
+	}
+	dev.ID = id
+	s.Devices[id] = dev
+	s.reindex()
+}
+
+// matchRandomized looks for an offline device with a randomized MAC and the
+// same hostname: the usual sign of a phone that rotated its private address.
+// Callers hold s.mu.
+func (s *Scanner) matchRandomized(hostname string, mac string) *models.Device {
+	if hostname == "" {
+		return nil
+	}
+	for _, dev := range s.Devices {
+		if dev.IsOnline || dev.Hostname != hostname || !isRandomizedMAC(dev.MAC) {
+			continue
+		}
+		log.Printf("Device %s rotated its private MAC %s -> %s", hostname, dev.MAC, mac)
+		return dev
+	}
+	return nil
+}
+
+// moveIP points ip at dev and records the address in its history.
+// Callers hold s.mu.
+func (s *Scanner) moveIP(dev *models.Device, ip string) {
+	now := time.Now()
+	if dev.IP != ip {
+		if s.byIP[dev.IP] == dev.ID {
+			delete(s.byIP, dev.IP)
+		}
+		dev.IP = ip
+	}
+	if previous := s.deviceAt(ip); previous != nil && previous != dev {
+		// Another device held this address before DHCP reassigned it
+		s.setOnline(previous, false)
+	}
+	s.byIP[ip] = dev.ID
+
+	n := len(dev.IPHistory)
+	if n > 0 && dev.IPHistory[n-1].IP == ip {
+		dev.IPHistory[n-1].LastSeen = now
+		return
+	}
+	dev.IPHistory = append(dev.IPHistory, models.IPLease{IP: ip, FirstSeen: now, LastSeen: now})
+	if len(dev.IPHistory) > maxIPHistory {
+		dev.IPHistory = dev.IPHistory[len(dev.IPHistory)-maxIPHistory:]
+	}
+}
+
+// reindex rebuilds the IP lookup after loading. Callers hold s.mu.
+func (s *Scanner) reindex() {
+	s.byIP = make(map[string]string, len(s.Devices))
+	for id, dev := range s.Devices {
+		if other, ok := s.byIP[dev.IP]; ok && s.Devices[other].LastSeen.After(dev.LastSeen) {
+			continue
+		}
+		s.byIP[dev.IP] = id
+	}
+}
+
+// migrateDevices converts a devices.json keyed by IP (older versions) into
+// one keyed by device ID. Entries that share a MAC are the same device seen
+// at different addresses and are merged into the most recently seen one.
+func migrateDevices(old map[string]*models.Device) (map[string]*models.Device, bool) {
+	migrated := false
+	list := make([]*models.Device, 0, len(old))
+	for key, dev := range old {
+		if dev.ID == "" || dev.ID != key {
+			migrated = true
+		}
+		list = append(list, dev)
+	}
+	if !migrated {
+		return old, false
+	}
+
+	// Newest first, so older entries merge into the current one
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+
+	devices := make(map[string]*models.Device, len(list))
+	for _, dev := range list {
+		if dev.ID == "" {
+			dev.ID = deviceID(dev.MAC, dev.IP)
+		}
+		if len(dev.IPHistory) == 0 {
+			dev.IPHistory = []models.IPLease{{IP: dev.IP, FirstSeen: dev.LastSeen, LastSeen: dev.LastSeen}}
+		}
+		if dev.FirstSeen.IsZero() {
+			dev.FirstSeen = dev.IPHistory[0].FirstSeen
+		}
+
+		current, exists := devices[dev.ID]
+		if !exists {
+			devices[dev.ID] = dev
+			continue
+		}
+		// Older entry of the same device: keep what the user named it
+		if current.FriendlyName == "" {
+			current.FriendlyName = dev.FriendlyName
+		}
+		if current.DeviceType == "" {
+			current.DeviceType = dev.DeviceType
+		}
+		if current.TypeOverride == "" {
+			current.TypeOverride = dev.TypeOverride
+		}
+		if current.Hostname == "" {
+			current.Hostname = dev.Hostname
+		}
+		if dev.FirstSeen.Before(current.FirstSeen) {
+			current.FirstSeen = dev.FirstSeen
+		}
+		current.IPHistory = append(dev.IPHistory, current.IPHistory...)
+		if len(current.IPHistory) > maxIPHistory {
+			current.IPHistory = current.IPHistory[len(current.IPHistory)-maxIPHistory:]
+		}
+	}
+
+	log.Printf("Migrated %d devices.json entries to %d devices keyed by MAC", len(old), len(devices))
+	return devices, true
+}
@@ -0,0 +1,111 @@
+package scanner
+
+import (
+	"homenet/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMigrateDevices(t *testing.T) {
+	now := time.Now()
+	old := map[string]*models.Device{
+		// The same laptop at two addresses, the older entry named by the user
+		"192.168.1.5": {IP: "192.168.1.5", MAC: "00:11:22:33:44:55", LastSeen: now},
+		"192.168.1.9": {IP: "192.168.1.9", MAC: "00:11:22:33:44:55", LastSeen: now.Add(-time.Hour), FriendlyName: "Laptop"},
+		// Already keyed by ID, and an old IP-keyed entry colliding with it
+		"mac-001122334466": {ID: "mac-001122334466", IP: "192.168.1.6", MAC: "00:11:22:33:44:66", LastSeen: now, Hostname: "printer"},
+		"192.168.1.7":      {IP: "192.168.1.7", MAC: "00:11:22:33:44:66", LastSeen: now.Add(-24 * time.Hour), DeviceType: "Printer"},
+		// Never reached over ARP
+		"192.168.1.20": {IP: "192.168.1.20", LastSeen: now},
+	}
+
+	devices, migrated := migrateDevices(old)
+	if !migrated {
+		t.Fatal("IP-keyed file not migrated")
+	}
+	if len(devices) != 3 {
+		t.Fatalf("got %d devices, want 3: %v", len(devices), devices)
+	}
+
+	laptop := devices["mac-001122334455"]
+	if laptop == nil || laptop.IP != "192.168.1.5" || laptop.FriendlyName != "Laptop" {
+		t.Errorf("laptop = %+v, want the newest entry with the user's name", laptop)
+	}
+	var ips []string
+	for _, lease := range laptop.IPHistory {
+		ips = append(ips, lease.IP)
+	}
+	if want := []string{"192.168.1.9", "192.168.1.5"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("IP history = %v, want %v", ips, want)
+	}
+
+	printer := devices["mac-001122334466"]
+	if printer == nil || printer.IP != "192.168.1.6" || printer.Hostname != "printer" || printer.DeviceType != "Printer" {
+		t.Errorf("printer = %+v, want the keyed entry with the old one's type", printer)
+	}
+	if !printer.FirstSeen.Equal(now.Add(-24 * time.Hour)) {
+		t.Errorf("printer first seen %v, want the older entry's", printer.FirstSeen)
+	}
+
+	if dev := devices["ip-192.168.1.20"]; dev == nil || dev.ID != "ip-192.168.1.20" {
+		t.Errorf("MAC-less device = %+v, want it keyed by address", dev)
+	}
+
+	// A file already keyed by ID is left alone
+	if _, migrated := migrateDevices(devices); migrated {
+		t.Error("migrated a file that was already keyed by ID")
+	}
+}
+
+func TestHistoryRenameMergesByTime(t *testing.T) {
+	h := LoadHistory("", 0)
+	start := time.Now().Add(-time.Hour)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+
+	// Known by address first, then by MAC from a later sighting
+	h.Record("ip-10.9.0.1", true, at(0))
+	h.Record("ip-10.9.0.1", false, at(10))
+	h.Record("ip-10.9.0.1", true, at(30))
+	h.Record("mac-001122334401", true, at(5))
+	h.Record("mac-001122334401", false, at(20))
+
+	h.Rename("ip-10.9.0.1", "mac-001122334401")
+	if _, ok := h.Transitions["ip-10.9.0.1"]; ok {
+		t.Error("old ID still has history")
+	}
+	var got []string
+	for _, tr := range h.Transitions["mac-001122334401"] {
+		got = append(got, tr.At.Sub(start).String()+map[bool]string{true: " up", false: " down"}[tr.Online])
+	}
+	// In time order, without the repeated online at 5m
+	if want := []string{"0s up", "10m0s down", "30m0s up"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merged history = %v, want %v", got, want)
+	}
+	if !h.Online("mac-001122334401") {
+		t.Error("merged history does not end online")
+	}
+}
+
+func TestRekeyMovesHistory(t *testing.T) {
+	s := newProbeScanner(t)
+	s.mu.Lock()
+	dev, _ := s.identify("10.9.0.1", "", "")
+	s.setOnline(dev, true)
+	if dev.ID != "ip-10.9.0.1" {
+		t.Fatalf("device keyed %s, want by address", dev.ID)
+	}
+
+	// The MAC shows up later: same device, new key, history follows
+	again, isNew := s.identify("10.9.0.1", "00:11:22:33:44:01", "")
+	s.mu.Unlock()
+	if again != dev || isNew {
+		t.Fatalf("identify with MAC returned a new device %+v", again)
+	}
+	if dev.ID != "mac-001122334401" || s.Devices["ip-10.9.0.1"] != nil {
+		t.Errorf("device keyed %s, want by MAC only", dev.ID)
+	}
+	if !s.History.Online(dev.ID) || len(s.History.Transitions["ip-10.9.0.1"]) != 0 {
+		t.Errorf("history not moved to the new ID: %v", s.History.Transitions)
+	}
+}
@@ -0,0 +1,189 @@
+package scanner
+
+import (
+	"context"
+	"homenet/internal/models"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// ipv6Window is how long an address is kept after the device was last
+	// seen at another one, so rotated RFC 4941 temporary addresses fall away.
+	ipv6Window = 24 * time.Hour
+	// maxIPv6 caps the addresses kept per device, most recently seen first.
+	maxIPv6 = 16
+)
+
+// allNodes is the link-local all-nodes multicast group.
+var allNodes = net.ParseIP("ff02::1")
+
+// neighbor6 is one entry of the kernel's IPv6 neighbor table.
+type neighbor6 struct {
+	IP  net.IP
+	MAC string
+}
+
+// IPv6Scope labels an address for display: "link-local", "ULA" or "global".
+func IPv6Scope(addr string) string {
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.IsLinkLocalUnicast():
+		return "link-local"
+	case ip.IsPrivate():
+		return "ULA"
+	}
+	return "global"
+}
+
+// pingAllNodes sends one ICMPv6 echo to ff02::1 on every multicast-capable
+// interface. Every IPv6 host on the link answers, which also fills the
+// kernel neighbor table with their MAC addresses.
+func pingAllNodes(timeout time.Duration) (map[string]bool, error) {
+	conn, err := icmp.ListenPacket("udp6", "::")
+	datagram := err == nil
+	if !datagram {
+		if conn, err = icmp.ListenPacket("ip6:ipv6-icmp", "::"); err != nil {
+			return nil, err
+		}
+	}
+	defer conn.Close()
+
+	msg := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Body: &icmp.Echo{ID: os.Getpid() & 0xffff, Seq: 1, Data: []byte("homenet")},
+	}
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		var dst net.Addr = &net.IPAddr{IP: allNodes, Zone: iface.Name}
+		if datagram {
+			dst = &net.UDPAddr{IP: allNodes, Zone: iface.Name}
+		}
+		conn.WriteTo(data, dst)
+	}
+
+	replied := make(map[string]bool)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Read deadline reached
+			return replied, nil
+		}
+		reply, err := icmp.ParseMessage(58, buf[:n]) // 58 = ICMPv6
+		if err != nil || reply.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		switch addr := peer.(type) {
+		case *net.UDPAddr:
+			replied[addr.IP.String()] = true
+		case *net.IPAddr:
+			replied[addr.IP.String()] = true
+		}
+	}
+}
+
+// ipv6Probe wakes up IPv6 hosts with a multicast ping and reports the
+// addresses in the neighbor table, to be attached to the devices owning
+// those MACs. Failures are logged once.
+type ipv6Probe struct {
+	failed bool
+}
+
+func (p *ipv6Probe) Name() string { return ProbeIPv6 }
+
+func (p *ipv6Probe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	// Not fatal: the neighbor table still lists hosts we talked to
+	if _, err := pingAllNodes(pingTimeout); err != nil && !p.failed {
+		log.Printf("IPv6 multicast ping unavailable: %v", err)
+		p.failed = true
+	}
+
+	neighbors, err := readNeighbors6()
+	if err != nil {
+		if !p.failed {
+			log.Printf("IPv6 neighbor table unavailable: %v", err)
+			p.failed = true
+		}
+		return nil, nil
+	}
+
+	list := make([]Observation, 0, len(neighbors))
+	for _, n := range neighbors {
+		list = append(list, Observation{MAC: n.MAC, IPv6: []string{n.IP.String()}})
+	}
+	return list, nil
+}
+
+// addIPv6 records that dev was seen at addrs and drops the addresses it
+// has stopped using: those last seen more than ipv6Window before its newest
+// sighting, then the least recently seen beyond maxIPv6. Callers hold s.mu.
+func addIPv6(dev *models.Device, addrs []string, now time.Time) {
+	if dev.IPv6Seen == nil {
+		dev.IPv6Seen = make(map[string]time.Time)
+	}
+	for _, addr := range dev.IPv6 {
+		// Loaded from a file written before sightings were recorded
+		if _, ok := dev.IPv6Seen[addr]; !ok {
+			dev.IPv6Seen[addr] = now
+		}
+	}
+	for _, addr := range addrs {
+		if !contains(dev.IPv6, addr) {
+			dev.IPv6 = append(dev.IPv6, addr)
+		}
+		dev.IPv6Seen[addr] = now
+	}
+
+	var newest time.Time
+	for _, seen := range dev.IPv6Seen {
+		if seen.After(newest) {
+			newest = seen
+		}
+	}
+	recent := append([]string(nil), dev.IPv6...)
+	sort.SliceStable(recent, func(i, j int) bool {
+		return dev.IPv6Seen[recent[i]].After(dev.IPv6Seen[recent[j]])
+	})
+	for i, addr := range recent {
+		if i >= maxIPv6 || newest.Sub(dev.IPv6Seen[addr]) > ipv6Window {
+			delete(dev.IPv6Seen, addr)
+		}
+	}
+	kept := dev.IPv6[:0]
+	for _, addr := range dev.IPv6 {
+		if _, ok := dev.IPv6Seen[addr]; ok {
+			kept = append(kept, addr)
+		}
+	}
+	dev.IPv6 = kept
+	sortIPv6(dev.IPv6)
+}
+
+// sortIPv6 orders addresses link-local first, then ULA, then global.
+func sortIPv6(list []string) {
+	rank := map[string]int{"link-local": 0, "ULA": 1, "global": 2}
+	sort.SliceStable(list, func(i, j int) bool {
+		return rank[IPv6Scope(list[i])] < rank[IPv6Scope(list[j])]
+	})
+}
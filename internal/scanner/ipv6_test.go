@@ -0,0 +1,46 @@
+package scanner
+
+import (
+	"fmt"
+	"homenet/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddIPv6DropsRotatedAddresses(t *testing.T) {
+	dev := &models.Device{IPv6: []string{"fe80::1"}} // From an older devices file
+	start := time.Now()
+
+	addIPv6(dev, []string{"2001:db8::a"}, start)
+	addIPv6(dev, []string{"fe80::1", "2001:db8::b"}, start.Add(ipv6Window/2))
+	if want := []string{"fe80::1", "2001:db8::a", "2001:db8::b"}; !reflect.DeepEqual(dev.IPv6, want) {
+		t.Fatalf("addresses = %v, want %v", dev.IPv6, want)
+	}
+
+	// The first temporary address has not been seen for over a window
+	addIPv6(dev, []string{"fe80::1", "2001:db8::c"}, start.Add(ipv6Window+time.Hour))
+	if want := []string{"fe80::1", "2001:db8::b", "2001:db8::c"}; !reflect.DeepEqual(dev.IPv6, want) {
+		t.Errorf("addresses = %v, want %v", dev.IPv6, want)
+	}
+	if _, ok := dev.IPv6Seen["2001:db8::a"]; ok {
+		t.Error("dropped address still has a sighting")
+	}
+}
+
+func TestAddIPv6Cap(t *testing.T) {
+	dev := &models.Device{}
+	start := time.Now()
+	for i := 0; i < maxIPv6+5; i++ {
+		addIPv6(dev, []string{fmt.Sprintf("2001:db8::%x", i)}, start.Add(time.Duration(i)*time.Minute))
+	}
+	if len(dev.IPv6) != maxIPv6 || len(dev.IPv6Seen) != maxIPv6 {
+		t.Fatalf("kept %d addresses (%d sightings), want %d", len(dev.IPv6), len(dev.IPv6Seen), maxIPv6)
+	}
+	// The oldest ones went first
+	for i := 0; i < 5; i++ {
+		if addr := fmt.Sprintf("2001:db8::%x", i); contains(dev.IPv6, addr) {
+			t.Errorf("kept %s, one of the oldest addresses", addr)
+		}
+	}
+}
@@ -2,122 +2,463 @@ package scanner
 
 import (
 	"context"
-	"fmt"
+	"homenet/internal/models"
+	"net"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/grandcat/zeroconf"
+	"github.com/miekg/dns"
 )
 
-// scanMDNS performs a multicast DNS discovery on the network.
-func (s *Scanner) scanMDNS() {
-	resolver, err := zeroconf.NewResolver(nil)
+const (
+	mdnsServiceTypes = "_services._dns-sd._udp.local."
+	mdnsRoundWait    = 1500 * time.Millisecond // Time to collect answers per query round
+)
+
+var (
+	mdnsGroup4 = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	mdnsGroup6 = net.ParseIP("ff02::fb")
+)
+
+// mdnsClient sends one-shot mDNS queries (RFC 6762 section 5.1) from an
+// ordinary UDP port, so responders answer us directly. Its sockets stay open
+// and are reused across scans.
+type mdnsClient struct {
+	conn4  *net.UDPConn
+	conn6  *net.UDPConn // nil without IPv6
+	ifaces []net.Interface
+}
+
+func newMDNSClient() (*mdnsClient, error) {
+	conn4, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	c := &mdnsClient{conn4: conn4}
+	if conn6, err := net.ListenUDP("udp6", &net.UDPAddr{}); err == nil {
+		c.conn6 = conn6
+	}
+
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+			c.ifaces = append(c.ifaces, iface)
+		}
+	}
+	return c, nil
+}
+
+// mdnsRecords gathers every record seen during one enumeration.
+type mdnsRecords struct {
+	ptr  map[string][]string // Service type or enumeration name to PTR targets
+	srv  map[string]*dns.SRV // Instance name to SRV
+	txt  map[string][]string // Instance name to TXT strings
+	addr map[string][]net.IP // Host name to A/AAAA addresses
+	from map[string]net.IP   // Instance name to the responder address
+}
+
+type mdnsAnswer struct {
+	msg  *dns.Msg
+	from net.IP
+}
+
+// query sends the questions to both multicast groups and collects every
+// answer that arrives within wait, or until ctx is done.
+func (c *mdnsClient) query(ctx context.Context, questions []dns.Question, wait time.Duration, recs *mdnsRecords) {
+	if len(questions) == 0 || ctx.Err() != nil {
+		return
+	}
+	m := new(dns.Msg)
+	m.Id = dns.Id()
+	m.RecursionDesired = false
+	m.Question = questions
+	data, err := m.Pack()
 	if err != nil {
-		fmt.Printf("Failed to initialize mDNS resolver: %v\n", err)
 		return
 	}
 
-	serviceTypes := []string{
-		"_workstation._tcp",
-		"_googlecast._tcp",
-		"_airplay._tcp",
-		"_printer._tcp",
-		"_ipp._tcp",
-		"_spotify-connect._tcp",
-		"_hap._tcp", // HomeKit
-		"_http._tcp",
-		"_smb._tcp",
-	}
-
-	var wg sync.WaitGroup
-	// Use a shorter timeout per scan to keep UI responsive
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	for _, service := range serviceTypes {
-		wg.Add(1)
-		go func(srv string) {
-			defer wg.Done()
-			
-			entries := make(chan *zeroconf.ServiceEntry)
-			
-			// Process results for this service type
-			go func(results <-chan *zeroconf.ServiceEntry) {
-				for entry := range results {
-					s.processMDNSEntry(entry)
+	c.conn4.WriteToUDP(data, mdnsGroup4)
+	if c.conn6 != nil {
+		for _, iface := range c.ifaces {
+			c.conn6.WriteToUDP(data, &net.UDPAddr{IP: mdnsGroup6, Port: 5353, Zone: iface.Name})
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	msgs := make(chan mdnsAnswer, 64)
+	done := make(chan struct{}, 2)
+	readers := 0
+	for _, conn := range []*net.UDPConn{c.conn4, c.conn6} {
+		if conn == nil {
+			continue
+		}
+		readers++
+		conn.SetReadDeadline(deadline)
+		go func(conn *net.UDPConn) {
+			defer func() { done <- struct{}{} }()
+			buf := make([]byte, 9000)
+			for {
+				n, peer, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					// Read deadline reached
+					return
+				}
+				resp := new(dns.Msg)
+				if resp.Unpack(buf[:n]) != nil || !resp.Response {
+					continue
 				}
-			}(entries)
+				msgs <- mdnsAnswer{resp, peer.IP}
+			}
+		}(conn)
+	}
+	// The sockets are reused, so cut the wait short instead of closing them
+	stop := context.AfterFunc(ctx, func() {
+		c.conn4.SetReadDeadline(time.Now())
+		if c.conn6 != nil {
+			c.conn6.SetReadDeadline(time.Now())
+		}
+	})
+	defer stop()
+
+	for readers > 0 {
+		select {
+		case a := <-msgs:
+			recs.add(a.msg, a.from)
+		case <-done:
+			readers--
+		}
+	}
+	// Drain anything read just before the deadline
+	for {
+		select {
+		case a := <-msgs:
+			recs.add(a.msg, a.from)
+		default:
+			return
+		}
+	}
+}
 
-			if err := resolver.Browse(ctx, srv, "local.", entries); err != nil {
-				// Log error but continue
-				// fmt.Printf("Failed to browse %s: %v\n", srv, err)
+func (r *mdnsRecords) add(m *dns.Msg, from net.IP) {
+	sections := append(append(m.Answer, m.Ns...), m.Extra...)
+	for _, rr := range sections {
+		name := mdnsKey(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.PTR:
+			if !contains(r.ptr[name], rr.Ptr) {
+				r.ptr[name] = append(r.ptr[name], rr.Ptr)
 			}
-			
-			// The resolver will close 'entries' when context is done or search finishes
-			<-ctx.Done()
-		}(service)
+		case *dns.SRV:
+			r.srv[name] = rr
+			r.from[name] = from
+		case *dns.TXT:
+			r.txt[name] = rr.Txt
+			r.from[name] = from
+		case *dns.A:
+			r.addAddr(name, rr.A)
+		case *dns.AAAA:
+			r.addAddr(name, rr.AAAA)
+		}
 	}
+}
 
-	wg.Wait()
+func (r *mdnsRecords) addAddr(host string, ip net.IP) {
+	for _, known := range r.addr[host] {
+		if known.Equal(ip) {
+			return
+		}
+	}
+	r.addr[host] = append(r.addr[host], ip)
 }
 
-func (s *Scanner) processMDNSEntry(entry *zeroconf.ServiceEntry) {
-	if len(entry.AddrIPv4) == 0 {
-		return
+// enumerate lists every advertised service type, then every instance of
+// each, then fills in whatever SRV, TXT and address records are missing.
+// Once ctx is done it returns what it has so far.
+func (c *mdnsClient) enumerate(ctx context.Context) *mdnsRecords {
+	recs := &mdnsRecords{
+		ptr:  make(map[string][]string),
+		srv:  make(map[string]*dns.SRV),
+		txt:  make(map[string][]string),
+		addr: make(map[string][]net.IP),
+		from: make(map[string]net.IP),
+	}
+
+	c.query(ctx, []dns.Question{{Name: mdnsServiceTypes, Qtype: dns.TypePTR, Qclass: dns.ClassINET}}, mdnsRoundWait, recs)
+
+	var questions []dns.Question
+	for _, service := range recs.ptr[mdnsServiceTypes] {
+		questions = append(questions, dns.Question{Name: service, Qtype: dns.TypePTR, Qclass: dns.ClassINET})
+	}
+	c.queryBatched(ctx, questions, recs)
+
+	questions = nil
+	for service, instances := range recs.ptr {
+		if service == mdnsServiceTypes {
+			continue
+		}
+		for _, instance := range instances {
+			key := mdnsKey(instance)
+			if recs.srv[key] == nil {
+				questions = append(questions, dns.Question{Name: instance, Qtype: dns.TypeSRV, Qclass: dns.ClassINET})
+			}
+			if recs.txt[key] == nil {
+				questions = append(questions, dns.Question{Name: instance, Qtype: dns.TypeTXT, Qclass: dns.ClassINET})
+			}
+		}
 	}
-	ip := entry.AddrIPv4[0].String()
-	name := entry.Instance
-	
-	// Clean up name (remove @ hostname part if present)
-	if idx := strings.Index(name, "@"); idx != -1 {
-		name = name[:idx]
+	c.queryBatched(ctx, questions, recs)
+
+	questions = nil
+	for _, srv := range recs.srv {
+		if len(recs.addr[mdnsKey(srv.Target)]) == 0 {
+			questions = append(questions,
+				dns.Question{Name: srv.Target, Qtype: dns.TypeA, Qclass: dns.ClassINET},
+				dns.Question{Name: srv.Target, Qtype: dns.TypeAAAA, Qclass: dns.ClassINET})
+		}
 	}
-	
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	c.queryBatched(ctx, questions, recs)
+	return recs
+}
 
-	// Only update existing devices that we've already discovered via scan/ARP
-	if dev, exists := s.Devices[ip]; exists {
+// queryBatched keeps each query to a modest number of questions so the
+// answers fit in a single datagram.
+func (c *mdnsClient) queryBatched(ctx context.Context, questions []dns.Question, recs *mdnsRecords) {
+	const batch = 8
+	for len(questions) > 0 {
+		n := batch
+		if n > len(questions) {
+			n = len(questions)
+		}
+		c.query(ctx, questions[:n], mdnsRoundWait/2, recs)
+		questions = questions[n:]
+	}
+}
+
+// mdnsHost is everything one advertising host told us.
+type mdnsHost struct {
+	name     string
+	ipv4     []net.IP
+	ipv6     []net.IP
+	services []models.MDNSService
+}
+
+// hosts groups the service instances by the host that offers them.
+func (r *mdnsRecords) hosts() []*mdnsHost {
+	byName := make(map[string]*mdnsHost)
+	for service, instances := range r.ptr {
+		if service == mdnsServiceTypes {
+			continue
+		}
+		for _, instance := range instances {
+			key := mdnsKey(instance)
+			srv := r.srv[key]
+			if srv == nil {
+				continue
+			}
+			hostKey := mdnsKey(srv.Target)
+			h := byName[hostKey]
+			if h == nil {
+				h = &mdnsHost{name: strings.TrimSuffix(strings.TrimSuffix(srv.Target, "."), ".local")}
+				for _, ip := range r.addr[hostKey] {
+					if ip.To4() != nil {
+						h.ipv4 = append(h.ipv4, ip.To4())
+					} else {
+						h.ipv6 = append(h.ipv6, ip)
+					}
+				}
+				// No address records: fall back to whoever answered
+				if len(h.ipv4) == 0 && len(h.ipv6) == 0 && r.from[key] != nil {
+					if ip := r.from[key]; ip.To4() != nil {
+						h.ipv4 = append(h.ipv4, ip.To4())
+					} else {
+						h.ipv6 = append(h.ipv6, ip)
+					}
+				}
+				byName[hostKey] = h
+			}
+
+			h.services = append(h.services, models.MDNSService{
+				Instance: instanceLabel(instance, service),
+				Service:  strings.TrimSuffix(service, ".local."),
+				Host:     strings.TrimSuffix(srv.Target, "."),
+				Port:     int(srv.Port),
+				TXT:      parseTXT(r.txt[key]),
+			})
+		}
+	}
+
+	list := make([]*mdnsHost, 0, len(byName))
+	for _, h := range byName {
+		sort.Slice(h.services, func(i, j int) bool {
+			if h.services[i].Service != h.services[j].Service {
+				return h.services[i].Service < h.services[j].Service
+			}
+			return h.services[i].Instance < h.services[j].Instance
+		})
+		list = append(list, h)
+	}
+	return list
+}
+
+// mdnsKey canonicalises a name for lookups: responders differ in case and in
+// how they escape spaces ("\032" or "\ ").
+func mdnsKey(name string) string {
+	return strings.ToLower(unescapeDNS(name))
+}
+
+// instanceLabel strips the service type from a full instance name.
+func instanceLabel(instance string, service string) string {
+	if strings.HasSuffix(mdnsKey(instance), "."+service) {
+		instance = unescapeDNS(instance)
+		return instance[:len(instance)-len(service)-1]
+	}
+	return unescapeDNS(instance)
+}
+
+// parseTXT splits "key=value" strings; keys without "=" map to "".
+func parseTXT(txt []string) map[string]string {
+	if len(txt) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(txt))
+	for _, entry := range txt {
+		if entry == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// unescapeDNS turns a presentation-format label like "Living\ Room\226\128\153s TV"
+// back into plain text.
+func unescapeDNS(label string) string {
+	if !strings.Contains(label, `\`) {
+		return label
+	}
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		if label[i] != '\\' || i+1 >= len(label) {
+			b.WriteByte(label[i])
+			continue
+		}
+		if i+3 < len(label) && isDigit(label[i+1]) && isDigit(label[i+2]) && isDigit(label[i+3]) {
+			b.WriteByte((label[i+1]-'0')*100 + (label[i+2]-'0')*10 + (label[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(label[i+1])
+		i++
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// mdnsFresh is how long an mDNS answer keeps a host online: two full sweeps,
+// since the liveness checks in between do not query mDNS.
+func (s *Scanner) mdnsFresh() time.Duration {
+	return 2 * s.Schedule.withDefaults().FullSweep
+}
+
+// heardMDNS reports whether ip answered mDNS recently. Callers hold s.mu.
+func (s *Scanner) heardMDNS(ip string, now time.Time) bool {
+	heard, ok := s.mdnsHeard[ip]
+	return ok && now.Sub(heard) < s.mdnsFresh()
+}
+
+// expireIPv6Only takes hosts known only by an IPv6 address offline once
+// their last mDNS answer is stale, and forgets stale answers. Callers hold
+// s.mu.
+func (s *Scanner) expireIPv6Only(now time.Time) {
+	for _, dev := range s.Devices {
+		if dev.IsOnline && net.ParseIP(dev.IP).To4() == nil && !s.heardMDNS(dev.IP, now) {
+			s.setOnline(dev, false)
+		}
+	}
+	for ip := range s.mdnsHeard {
+		if !s.heardMDNS(ip, now) {
+			delete(s.mdnsHeard, ip)
+		}
+	}
+}
+
+// mdnsProbe enumerates every DNS-SD service on the network and reports the
+// instances of each host, adding hosts seen only over mDNS (e.g. a phone that
+// ignores ARP and ping).
+type mdnsProbe struct {
+	s      *Scanner
+	client *mdnsClient // Opened on the first run and reused across scans
+}
+
+func (p *mdnsProbe) Name() string { return ProbeMDNS }
+
+func (p *mdnsProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	if p.client == nil {
+		client, err := newMDNSClient()
+		if err != nil {
+			return nil, err
+		}
+		p.client = client
+	}
+
+	var list []Observation
+	for _, host := range p.client.enumerate(ctx).hosts() {
+		if o, ok := p.s.mdnsObservation(host); ok {
+			list = append(list, o)
+		}
+	}
+	return list, nil
+}
+
+func (s *Scanner) mdnsObservation(host *mdnsHost) (Observation, bool) {
+	// Use the in-range IPv4 address; hosts with only IPv6 are keyed by their
+	// first IPv6 address
+	var ip string
+	for _, addr := range host.ipv4 {
+		if s.inScope(addr.String()) {
+			ip = addr.String()
+			break
+		}
+	}
+	if ip == "" && len(host.ipv4) == 0 && len(host.ipv6) > 0 {
+		ip = host.ipv6[0].String()
+	}
+	if ip == "" {
+		return Observation{}, false
+	}
+
+	o := Observation{IP: ip, Answered: true, Name: host.name}
+	for _, v6 := range host.ipv6 {
+		o.IPv6 = append(o.IPv6, v6.String())
+	}
+	services := host.services
+	friendly := mdnsFriendlyName(host)
+	o.Apply = func(dev *models.Device) {
+		dev.MDNSServices = services
 		// Update Friendly Name if empty or currently just hostname
-		if dev.FriendlyName == "" || dev.FriendlyName == dev.Hostname {
-			dev.FriendlyName = name
-		}
-		
-		// Update Device Type if unknown
-		inferredType := inferDeviceType(entry.Service)
-		if dev.DeviceType == "" || dev.DeviceType == "Unknown" {
-			dev.DeviceType = inferredType
-		}
-		
-		// Store Raw Info
-		if dev.MDNSInfo == nil {
-			dev.MDNSInfo = make(map[string]string)
-		}
-		// Store first text record as example
-		if len(entry.Text) > 0 {
-			dev.MDNSInfo[entry.Service] = entry.Text[0]
-		}
-	}
-}
-
-func inferDeviceType(service string) string {
-	switch service {
-	case "_googlecast._tcp":
-		return "Chromecast/Speaker"
-	case "_airplay._tcp":
-		return "Apple Device"
-	case "_printer._tcp", "_ipp._tcp":
-		return "Printer"
-	case "_spotify-connect._tcp":
-		return "Speaker"
-	case "_hap._tcp":
-		return "Smart Home"
-	case "_workstation._tcp", "_smb._tcp":
-		return "Computer/NAS"
-	case "_http._tcp":
-		return "Web Server"
-	default:
-		return "Unknown"
+		if friendly != "" && (dev.FriendlyName == "" || dev.FriendlyName == dev.Hostname) {
+			dev.FriendlyName = friendly
+		}
+	}
+	return o, true
+}
+
+// mdnsFriendlyName picks a display name for a host: the instance name of its
+// first service (they are sorted, so the choice is stable), or the host name
+// if it advertises none.
+func mdnsFriendlyName(host *mdnsHost) string {
+	for _, svc := range host.services {
+		// Clean up name (remove @ hostname part if present)
+		name := svc.Instance
+		if idx := strings.Index(name, "@"); idx != -1 {
+			name = name[:idx]
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
 	}
+	return host.name
 }
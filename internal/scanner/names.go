@@ -0,0 +1,239 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"errors"
+	"homenet/internal/models"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Name sources, in the order they are tried by default.
+const (
+	NameDNS     = "dns"     // Reverse DNS (PTR) through the system resolver
+	NameDHCP    = "dhcp"    // Option 12 of a snooped DHCP request
+	NameMDNS    = "mdns"    // Host name announced over multicast DNS
+	NameNetBIOS = "netbios" // NetBIOS node status (UDP 137), answered by Windows and Samba
+	NameLLMNR   = "llmnr"   // Link-Local Multicast Name Resolution PTR query (UDP 5355)
+)
+
+const (
+	nameTimeout = time.Second
+	nameRefresh = time.Hour // How often names are looked up again
+)
+
+// DefaultNameSources is the hostname priority used unless configured.
+func DefaultNameSources() []string {
+	return []string{NameDNS, NameDHCP, NameMDNS, NameNetBIOS, NameLLMNR}
+}
+
+// updateNames queries the active name sources for ip at most once per
+// nameRefresh and picks the device's hostname by priority.
+func (s *Scanner) updateNames(ip string) {
+	s.mu.RLock()
+	dev := s.deviceAt(ip)
+	if dev == nil {
+		s.mu.RUnlock()
+		return
+	}
+	id := dev.ID
+	checked, seen := s.namesChecked[id]
+	s.mu.RUnlock()
+	if seen && time.Since(checked) < nameRefresh {
+		return
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		found = make(map[string]string)
+	)
+	lookups := map[string]func(string) string{
+		NameDNS:     lookupPTR,
+		NameNetBIOS: lookupNetBIOS,
+		NameLLMNR:   lookupLLMNR,
+	}
+	for _, source := range s.NameSources {
+		lookup, ok := lookups[source]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(source string, lookup func(string) string) {
+			defer wg.Done()
+			if name := lookup(ip); name != "" {
+				mu.Lock()
+				found[source] = name
+				mu.Unlock()
+			}
+		}(source, lookup)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.namesChecked[id] = time.Now()
+	if dev = s.Devices[id]; dev == nil {
+		return
+	}
+	for source, name := range found {
+		s.setName(dev, source, name)
+	}
+}
+
+// setName records a name from one source and re-picks the hostname.
+// Callers hold s.mu.
+func (s *Scanner) setName(dev *models.Device, source string, name string) {
+	if dev.Names == nil {
+		dev.Names = make(map[string]string)
+	}
+	dev.Names[source] = name
+
+	for _, preferred := range s.NameSources {
+		if n := dev.Names[preferred]; n != "" {
+			dev.Hostname, dev.HostnameSource = n, preferred
+			return
+		}
+	}
+}
+
+func lookupPTR(ip string) string {
+	names, _ := net.LookupAddr(ip)
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// lookupLLMNR sends a unicast LLMNR PTR query, as RFC 4795 prescribes for
+// reverse lookups.
+func lookupLLMNR(ip string) string {
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(arpa, dns.TypePTR)
+	m.RecursionDesired = false
+	query, err := m.Pack()
+	if err != nil {
+		return ""
+	}
+
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip, "5355"), nameTimeout)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if _, err := conn.Write(query); err != nil {
+		return ""
+	}
+	conn.SetReadDeadline(time.Now().Add(nameTimeout))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	name, _ := parseLLMNRResponse(buf[:n], m.Id)
+	return name
+}
+
+// parseLLMNRResponse returns the name in the first PTR answer of a response
+// to the query with the given ID.
+func parseLLMNRResponse(pkt []byte, id uint16) (string, error) {
+	resp := new(dns.Msg)
+	if err := resp.Unpack(pkt); err != nil {
+		return "", err
+	}
+	if !resp.Response || resp.Id != id {
+		return "", errors.New("not a response to our LLMNR query")
+	}
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return strings.TrimSuffix(ptr.Ptr, "."), nil
+		}
+	}
+	return "", errors.New("no PTR record in LLMNR response")
+}
+
+// lookupNetBIOS asks for the node status table and returns the machine's
+// workstation name.
+func lookupNetBIOS(ip string) string {
+	conn, err := net.DialTimeout("udp4", net.JoinHostPort(ip, "137"), nameTimeout)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(netbiosStatusRequest(uint16(rand.Intn(0x10000)))); err != nil {
+		return ""
+	}
+	conn.SetReadDeadline(time.Now().Add(nameTimeout))
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return ""
+	}
+	name, _ := parseNetBIOSStatus(buf[:n])
+	return name
+}
+
+// netbiosStatusRequest builds an NBSTAT query for the wildcard name "*".
+func netbiosStatusRequest(id uint16) []byte {
+	pkt := make([]byte, 12, 50)
+	binary.BigEndian.PutUint16(pkt[0:], id)
+	binary.BigEndian.PutUint16(pkt[4:], 1) // QDCOUNT
+
+	// "*" padded with NULs to 16 bytes, first-level encoded as 32 letters
+	name := make([]byte, 16)
+	name[0] = '*'
+	pkt = append(pkt, 0x20)
+	for _, b := range name {
+		pkt = append(pkt, 'A'+b>>4, 'A'+b&0x0f)
+	}
+	pkt = append(pkt, 0x00)
+	pkt = append(pkt, 0x00, 0x21, 0x00, 0x01) // NBSTAT, IN
+	return pkt
+}
+
+// parseNetBIOSStatus returns the unique workstation (<00>) name from a node
+// status response.
+func parseNetBIOSStatus(pkt []byte) (string, error) {
+	errShort := errors.New("short NetBIOS response")
+	if len(pkt) < 12 || binary.BigEndian.Uint16(pkt[6:]) == 0 {
+		return "", errShort
+	}
+
+	// Skip the answer name: a compression pointer or length-prefixed labels
+	off := 12
+	if off < len(pkt) && pkt[off]&0xc0 == 0xc0 {
+		off += 2
+	} else {
+		for off < len(pkt) && pkt[off] != 0 {
+			off += int(pkt[off]) + 1
+		}
+		off++
+	}
+	off += 10 // TYPE, CLASS, TTL, RDLENGTH
+	if off >= len(pkt) {
+		return "", errShort
+	}
+
+	count := int(pkt[off])
+	off++
+	for i := 0; i < count && off+18 <= len(pkt); i++ {
+		entry := pkt[off : off+18]
+		off += 18
+		suffix := entry[15]
+		group := entry[16]&0x80 != 0
+		if suffix == 0x00 && !group {
+			return strings.TrimRight(string(entry[:15]), " \x00"), nil
+		}
+	}
+	return "", errors.New("no workstation name in NetBIOS response")
+}
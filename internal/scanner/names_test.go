@@ -0,0 +1,148 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// netbiosEntry is one row of a node status name table.
+type netbiosEntry struct {
+	name   string
+	suffix byte
+	group  bool
+}
+
+// netbiosStatusResponse builds a node status answer listing entries.
+func netbiosStatusResponse(entries ...netbiosEntry) []byte {
+	pkt := make([]byte, 12)
+	binary.BigEndian.PutUint16(pkt[2:], 0x8400) // Response, authoritative
+	binary.BigEndian.PutUint16(pkt[6:], 1)      // ANCOUNT
+	// The answer repeats the question name
+	pkt = append(pkt, netbiosStatusRequest(0)[12:12+34]...)
+	pkt = append(pkt, 0x00, 0x21, 0x00, 0x01, 0, 0, 0, 0)
+	rdlen := 1 + 18*len(entries) + 46
+	pkt = append(pkt, byte(rdlen>>8), byte(rdlen))
+	pkt = append(pkt, byte(len(entries)))
+	for _, e := range entries {
+		name := []byte(e.name + "                ")[:15]
+		flags := byte(0x04) // Active
+		if e.group {
+			flags |= 0x80
+		}
+		pkt = append(pkt, name...)
+		pkt = append(pkt, e.suffix, flags, 0x00)
+	}
+	return append(pkt, make([]byte, 46)...) // Statistics: unit ID and counters
+}
+
+func TestParseNetBIOSStatus(t *testing.T) {
+	full := netbiosStatusResponse(
+		netbiosEntry{name: "WORKGROUP", suffix: 0x00, group: true},
+		netbiosEntry{name: "DESKTOP-7Q2K", suffix: 0x20},
+		netbiosEntry{name: "DESKTOP-7Q2K", suffix: 0x00},
+	)
+	nameEnd := 12 + 34
+	firstEntry := nameEnd + 10 + 1
+
+	for _, tc := range []struct {
+		name string
+		pkt  []byte
+		want string
+		err  bool
+	}{
+		{name: "workstation name", pkt: full, want: "DESKTOP-7Q2K"},
+		{name: "compressed answer name", pkt: append(append(append([]byte(nil), full[:12]...), 0xc0, 0x0c), full[nameEnd:]...), want: "DESKTOP-7Q2K"},
+		{name: "group names only", pkt: netbiosStatusResponse(netbiosEntry{name: "WORKGROUP", suffix: 0x00, group: true}), err: true},
+		{name: "no answers", pkt: append([]byte(nil), full[:6]...), err: true},
+		{name: "header only", pkt: full[:12], err: true},
+		{name: "cut in the answer name", pkt: full[:20], err: true},
+		{name: "cut before the count", pkt: full[:firstEntry-1], err: true},
+		{name: "cut in the table", pkt: full[:firstEntry+18+5], err: true},
+		{name: "count past the end", pkt: func() []byte {
+			p := append([]byte(nil), full[:firstEntry+18]...)
+			p[firstEntry-1] = 0xff
+			return p
+		}(), err: true},
+		{name: "label length past the end", pkt: append(append([]byte(nil), full[:12]...), 0x3f, 'A'), err: true},
+		{name: "empty", pkt: nil, err: true},
+	} {
+		got, err := parseNetBIOSStatus(tc.pkt)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("%s: got %q, %v; want %q, error %v", tc.name, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func llmnrResponse(t testing.TB, id uint16, answers ...string) []byte {
+	m := new(dns.Msg)
+	m.SetQuestion("5.1.168.192.in-addr.arpa.", dns.TypePTR)
+	m.Id = id
+	m.Response = true
+	for _, s := range answers {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Answer = append(m.Answer, rr)
+	}
+	pkt, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkt
+}
+
+func TestParseLLMNRResponse(t *testing.T) {
+	const id = 0x4242
+	full := llmnrResponse(t, id, "5.1.168.192.in-addr.arpa. 30 IN PTR laptop.")
+	query := llmnrResponse(t, id)
+	query[2] &^= 0x80 // QR bit cleared: our own query looped back
+
+	for _, tc := range []struct {
+		name string
+		pkt  []byte
+		want string
+		err  bool
+	}{
+		{name: "answer", pkt: full, want: "laptop"},
+		{name: "after another record", pkt: llmnrResponse(t, id,
+			"5.1.168.192.in-addr.arpa. 30 IN TXT \"x\"",
+			"5.1.168.192.in-addr.arpa. 30 IN PTR laptop."), want: "laptop"},
+		{name: "other query", pkt: llmnrResponse(t, id+1, "5.1.168.192.in-addr.arpa. 30 IN PTR laptop."), err: true},
+		{name: "query", pkt: query, err: true},
+		{name: "no answer", pkt: llmnrResponse(t, id), err: true},
+		{name: "truncated header", pkt: full[:5], err: true},
+		{name: "truncated answer", pkt: full[:len(full)-4], err: true},
+		{name: "empty", pkt: nil, err: true},
+	} {
+		got, err := parseLLMNRResponse(tc.pkt, id)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("%s: got %q, %v; want %q, error %v", tc.name, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func FuzzParseNetBIOSStatus(f *testing.F) {
+	full := netbiosStatusResponse(netbiosEntry{name: "NAS", suffix: 0x00})
+	for _, n := range []int{0, 8, 12, 13, 30, 46, 56, 57, 70, len(full)} {
+		f.Add(full[:n])
+	}
+	f.Fuzz(func(t *testing.T, pkt []byte) {
+		name, err := parseNetBIOSStatus(pkt)
+		if err == nil && len(name) > 15 {
+			t.Errorf("name %q longer than a NetBIOS name", name)
+		}
+	})
+}
+
+func FuzzParseLLMNRResponse(f *testing.F) {
+	full := llmnrResponse(f, 1, "5.1.168.192.in-addr.arpa. 30 IN PTR laptop.")
+	for _, n := range []int{0, 5, 12, 20, len(full) - 1, len(full)} {
+		f.Add(full[:n])
+	}
+	f.Fuzz(func(t *testing.T, pkt []byte) {
+		parseLLMNRResponse(pkt, 1)
+	})
+}
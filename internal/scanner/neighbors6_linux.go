@@ -0,0 +1,66 @@
+//go:build linux
+
+package scanner
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// readNeighbors6 dumps the kernel IPv6 neighbor table over rtnetlink.
+func readNeighbors6() ([]neighbor6, error) {
+	rib, err := syscall.NetlinkRIB(unix.RTM_GETNEIGH, unix.AF_INET6)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []neighbor6
+	for _, m := range msgs {
+		if m.Header.Type != unix.RTM_NEWNEIGH || len(m.Data) < unix.SizeofNdMsg {
+			continue
+		}
+		// struct ndmsg: family, pad, pad, ifindex, state, flags, type
+		state := binary.NativeEndian.Uint16(m.Data[8:10])
+		if state&(unix.NUD_INCOMPLETE|unix.NUD_FAILED|unix.NUD_NOARP) != 0 {
+			continue
+		}
+
+		var n neighbor6
+		attrs := m.Data[unix.SizeofNdMsg:]
+		for len(attrs) >= unix.SizeofRtAttr {
+			size := int(binary.NativeEndian.Uint16(attrs[0:2]))
+			typ := binary.NativeEndian.Uint16(attrs[2:4])
+			if size < unix.SizeofRtAttr || size > len(attrs) {
+				break
+			}
+			value := attrs[unix.SizeofRtAttr:size]
+			switch typ {
+			case unix.NDA_DST:
+				if len(value) == net.IPv6len {
+					n.IP = net.IP(append([]byte(nil), value...))
+				}
+			case unix.NDA_LLADDR:
+				if len(value) == 6 {
+					n.MAC = net.HardwareAddr(value).String()
+				}
+			}
+			// Attributes are padded to 4 bytes
+			next := (size + 3) &^ 3
+			if next > len(attrs) {
+				break
+			}
+			attrs = attrs[next:]
+		}
+		if n.IP != nil && n.MAC != "" {
+			list = append(list, n)
+		}
+	}
+	return list, nil
+}
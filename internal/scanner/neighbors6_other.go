@@ -0,0 +1,37 @@
+//go:build !linux
+
+package scanner
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// readNeighbors6 reads the IPv6 neighbor cache with netsh on Windows.
+func readNeighbors6() ([]neighbor6, error) {
+	if runtime.GOOS != "windows" {
+		return nil, errors.New("not supported on " + runtime.GOOS)
+	}
+	out, err := exec.Command("netsh", "interface", "ipv6", "show", "neighbors").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var list []neighbor6
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] == "Unreachable" || fields[2] == "Incomplete" {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		mac, err := net.ParseMAC(strings.ReplaceAll(fields[1], "-", ":"))
+		if ip == nil || ip.To4() != nil || err != nil || ip.IsMulticast() {
+			continue
+		}
+		list = append(list, neighbor6{IP: ip, MAC: mac.String()})
+	}
+	return list, nil
+}
@@ -0,0 +1,269 @@
+package scanner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PrivateAddress labels locally administered MACs, which phones and laptops
+// randomize per network, so no vendor can be derived from them.
+const PrivateAddress = "Private address"
+
+// ieeeRegistries are the IEEE assignment files, by the names the IEEE publishes them under.
+var ieeeRegistries = map[string]string{
+	"oui.csv":   "https://standards-oui.ieee.org/oui/oui.csv",     // MA-L, 24-bit prefixes
+	"mam.csv":   "https://standards-oui.ieee.org/oui28/mam.csv",   // MA-M, 28-bit prefixes
+	"oui36.csv": "https://standards-oui.ieee.org/oui36/oui36.csv", // MA-S, 36-bit prefixes
+}
+
+// builtinVendors is used until the IEEE registry has been imported. It only
+// covers a handful of vendors common on home networks; most devices show no
+// manufacturer until -update-oui has been run.
+var builtinVendors = map[string]string{
+	"DCA632": "Raspberry Pi", "B827EB": "Raspberry Pi", "D83ADD": "Raspberry Pi",
+	"001A2B": "Cisco",
+	"F09E63": "Apple", "BCD1D3": "Apple", "000393": "Apple", "0017F2": "Apple",
+	"AC293A": "Canon",
+	"443839": "Cumulus",
+	"50E549": "Gigabyte",
+	"001132": "Synology",
+	"248D76": "Espressif", "84F3EB": "Espressif", // IoT chips
+	"005056": "VMware",
+	"000C29": "VMware",
+	"525400": "QEMU/KVM",
+}
+
+// VendorDB maps MAC prefixes of any length (in hex digits) to manufacturers.
+type VendorDB struct {
+	mu        sync.RWMutex
+	registry  map[string]string // IEEE MA-L/MA-M/MA-S assignments
+	overrides map[string]string // User-defined prefixes, checked first
+	lengths   []int             // Prefix lengths present, longest first
+}
+
+// NewVendorDB returns a database holding only the built-in prefixes.
+func NewVendorDB() *VendorDB {
+	db := &VendorDB{
+		registry:  make(map[string]string),
+		overrides: make(map[string]string),
+	}
+	for prefix, name := range builtinVendors {
+		db.registry[prefix] = name
+	}
+	db.index()
+	return db
+}
+
+// LoadVendorDB reads the IEEE registry files found in dir and the user
+// override file. Missing files are skipped, with a warning when there is no
+// registry at all.
+func LoadVendorDB(dir string, overridesFile string) (*VendorDB, error) {
+	db := NewVendorDB()
+	loaded := 0
+	for name := range ieeeRegistries {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := db.LoadIEEE(path); err != nil {
+			return db, err
+		}
+		loaded++
+	}
+	if loaded == 0 {
+		log.Printf("No IEEE vendor registry in %s, only %d built-in prefixes are known; run homenet -update-oui to download it", dir, len(builtinVendors))
+	}
+	if overridesFile != "" {
+		if err := db.LoadOverrides(overridesFile); err != nil && !os.IsNotExist(err) {
+			return db, err
+		}
+	}
+	return db, nil
+}
+
+// LoadIEEE imports an IEEE registry CSV (Registry,Assignment,Organization Name,...).
+func (db *VendorDB) LoadIEEE(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	entries := make(map[string]string)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if len(record) < 3 || record[0] == "Registry" {
+			continue
+		}
+		prefix := normalizeMAC(record[1])
+		if prefix == "" {
+			continue
+		}
+		entries[prefix] = strings.TrimSpace(record[2])
+	}
+
+	db.mu.Lock()
+	for prefix, name := range entries {
+		db.registry[prefix] = name
+	}
+	db.index()
+	db.mu.Unlock()
+
+	log.Printf("Loaded %d vendor prefixes from %s", len(entries), path)
+	return nil
+}
+
+// LoadOverrides reads a JSON object of prefix to name, e.g.
+// {"AA:BB:CC": "Lab switch", "70:B3:D5:12:3": "Garage sensor"}.
+func (db *VendorDB) LoadOverrides(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for prefix, name := range raw {
+		if p := normalizeMAC(prefix); p != "" {
+			db.overrides[p] = name
+		}
+	}
+	db.index()
+	return nil
+}
+
+// Lookup returns the manufacturer for a MAC address using the longest
+// matching prefix. User overrides win over everything. Locally administered
+// MACs are labelled "Private address" unless a prefix matches (the IEEE
+// never assigns those, but QEMU's built-in 52:54:00 is one).
+func (db *VendorDB) Lookup(mac string) string {
+	hex := normalizeMAC(mac)
+	if len(hex) < 6 {
+		return ""
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if name := db.match(db.overrides, hex); name != "" {
+		return name
+	}
+	if name := db.match(db.registry, hex); name != "" {
+		return name
+	}
+	if isLocallyAdministered(hex) {
+		return PrivateAddress
+	}
+	return ""
+}
+
+func (db *VendorDB) match(prefixes map[string]string, hex string) string {
+	for _, n := range db.lengths {
+		if n > len(hex) {
+			continue
+		}
+		if name, ok := prefixes[hex[:n]]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// index rebuilds the list of prefix lengths. Callers hold the write lock.
+func (db *VendorDB) index() {
+	seen := make(map[int]bool)
+	for _, m := range []map[string]string{db.registry, db.overrides} {
+		for prefix := range m {
+			seen[len(prefix)] = true
+		}
+	}
+	db.lengths = db.lengths[:0]
+	for n := range seen {
+		db.lengths = append(db.lengths, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(db.lengths)))
+}
+
+// DownloadOUI fetches the IEEE MA-L, MA-M and MA-S registries into dir.
+func DownloadOUI(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 2 * time.Minute}
+	for name, url := range ieeeRegistries {
+		resp, err := client.Get(url)
+		if err != nil {
+			return fmt.Errorf("download %s: %v", name, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("download %s: %s", name, resp.Status)
+		}
+
+		path := filepath.Join(dir, name)
+		tmp := path + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+		_, err = io.Copy(f, resp.Body)
+		resp.Body.Close()
+		f.Close()
+		if err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("download %s: %v", name, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeMAC strips separators and upper-cases a MAC address or prefix,
+// returning "" if it contains anything but hex digits.
+func normalizeMAC(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(strings.TrimSpace(s)) {
+		switch {
+		case r >= '0' && r <= '9', r >= 'A' && r <= 'F':
+			b.WriteRune(r)
+		case r == ':' || r == '-' || r == '.':
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// isLocallyAdministered checks the U/L bit of the first octet.
+func isLocallyAdministered(hex string) bool {
+	var first byte
+	if _, err := fmt.Sscanf(hex[:2], "%02X", &first); err != nil {
+		return false
+	}
+	return first&0x02 != 0
+}
@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVendorLookupLongestPrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "oui.csv"), `Registry,Assignment,Organization Name,Organization Address
+MA-L,70B3D5,IEEE Registration Authority,"445 Hoes Lane Piscataway NJ US 08554"
+MA-L,FCECDA,Ubiquiti Inc,"685 Third Avenue New York NY US 10017"
+`)
+	writeFile(t, filepath.Join(dir, "mam.csv"), `Registry,Assignment,Organization Name,Organization Address
+MA-M,70B3D51,Block Owner M,Somewhere
+`)
+	writeFile(t, filepath.Join(dir, "oui36.csv"), `Registry,Assignment,Organization Name,Organization Address
+MA-S,70B3D5123,Sensor Maker S,Elsewhere
+`)
+	db, err := LoadVendorDB(dir, filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadVendorDB: %v", err)
+	}
+
+	for _, tc := range []struct{ mac, want string }{
+		{"70:B3:D5:12:34:56", "Sensor Maker S"},              // MA-S beats MA-M and MA-L
+		{"70:b3:d5:1f:ff:ff", "Block Owner M"},               // MA-M beats MA-L
+		{"70-B3-D5-F0-00-01", "IEEE Registration Authority"}, // Only the MA-L matches
+		{"fc:ec:da:01:02:03", "Ubiquiti Inc"},
+		{"dc:a6:32:01:02:03", "Raspberry Pi"}, // Built in
+		{"00:00:5e:00:53:01", ""},
+		{"02:42:ac:11:00:02", PrivateAddress},
+		{"52:54:00:12:34:56", "QEMU/KVM"}, // Locally administered, but a known prefix
+		{"zz:zz:zz:zz:zz:zz", ""},
+		{"70:B3", ""},
+	} {
+		if got := db.Lookup(tc.mac); got != tc.want {
+			t.Errorf("Lookup(%s) = %q, want %q", tc.mac, got, tc.want)
+		}
+	}
+}
+
+func TestVendorOverrides(t *testing.T) {
+	dir := t.TempDir()
+	overrides := filepath.Join(dir, "oui_overrides.json")
+	writeFile(t, overrides, `{"DC:A6:32": "Home Assistant box", "00:11:22:33:4": "Lab switch", "not a prefix": "ignored"}`)
+	db, err := LoadVendorDB(dir, overrides)
+	if err != nil {
+		t.Fatalf("LoadVendorDB: %v", err)
+	}
+
+	for _, tc := range []struct{ mac, want string }{
+		{"dc:a6:32:01:02:03", "Home Assistant box"}, // Wins over the built-in name
+		{"00:11:22:33:44:55", "Lab switch"},
+		{"00:11:22:33:54:55", ""},
+		{"b8:27:eb:01:02:03", "Raspberry Pi"},
+	} {
+		if got := db.Lookup(tc.mac); got != tc.want {
+			t.Errorf("Lookup(%s) = %q, want %q", tc.mac, got, tc.want)
+		}
+	}
+
+	writeFile(t, overrides, `{"broken"`)
+	if _, err := LoadVendorDB(dir, overrides); err == nil {
+		t.Error("malformed overrides file accepted")
+	}
+}
@@ -0,0 +1,291 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"homenet/internal/models"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPortTimeout    = 300 * time.Millisecond
+	defaultConnectionsMax = 256 // Simultaneous TCP connection attempts across all hosts
+)
+
+// quickPorts are the services most often found on home networks.
+var quickPorts = []string{
+	"22", "53", "80", "443", "445", "548", "631", "1883", "3389", "5000",
+	"5353", "8000", "8008", "8080", "8123", "8443", "9100", "32400", "62078",
+}
+
+// common1000Ports is the list of the 1000 most frequently open TCP ports
+// (the same set nmap uses for its default scan).
+const common1000Ports = "" +
+	"1,3-4,6-7,9,13,17,19-26,30,32-33,37,42-43,49,53,70,79-85,88-90,99-100,106,109-111,113,119,125," +
+	"135,139,143-144,146,161,163,179,199,211-212,222,254-256,259,264,280,301,306,311,340,366,389," +
+	"406-407,416-417,425,427,443-445,458,464-465,481,497,500,512-515,524,541,543-545,548,554-555," +
+	"563,587,593,616-617,625,631,636,646,648,666-668,683,687,691,700,705,711,714,720,722,726,749," +
+	"765,777,783,787,800-801,808,843,873,880,888,898,900-903,911-912,981,987,990,992-993,995," +
+	"999-1002,1007,1009-1011,1021-1100,1102,1104-1108,1110-1114,1117,1119,1121-1124,1126,1130-1132," +
+	"1137-1138,1141,1145,1147-1149,1151-1152,1154,1163-1166,1169,1174-1175,1183,1185-1187,1192," +
+	"1198-1199,1201,1213,1216-1218,1233-1234,1236,1244,1247-1248,1259,1271-1272,1277,1287,1296," +
+	"1300-1301,1309-1311,1322,1328,1334,1352,1417,1433-1434,1443,1455,1461,1494,1500-1501,1503," +
+	"1521,1524,1533,1556,1580,1583,1594,1600,1641,1658,1666,1687-1688,1700,1717-1721,1723,1755," +
+	"1761,1782-1783,1801,1805,1812,1839-1840,1862-1864,1875,1900,1914,1935,1947,1971-1972,1974," +
+	"1984,1998-2010,2013,2020-2022,2030,2033-2035,2038,2040-2043,2045-2049,2065,2068,2099-2100," +
+	"2103,2105-2107,2111,2119,2121,2126,2135,2144,2160-2161,2170,2179,2190-2191,2196,2200,2222," +
+	"2251,2260,2288,2301,2323,2366,2381-2383,2393-2394,2399,2401,2492,2500,2522,2525,2557," +
+	"2601-2602,2604-2605,2607-2608,2638,2701-2702,2710,2717-2718,2725,2800,2809,2811,2869,2875," +
+	"2909-2910,2920,2967-2968,2998,3000-3001,3003,3005-3007,3011,3013,3017,3030-3031,3052,3071," +
+	"3077,3128,3168,3211,3221,3260-3261,3268-3269,3283,3300-3301,3306,3322-3325,3333,3351,3367," +
+	"3369-3372,3389-3390,3404,3476,3493,3517,3527,3546,3551,3580,3659,3689-3690,3703,3737,3766," +
+	"3784,3800-3801,3809,3814,3826-3828,3851,3869,3871,3878,3880,3889,3905,3914,3918,3920,3945," +
+	"3971,3986,3995,3998,4000-4006,4045,4111,4125-4126,4129,4224,4242,4279,4321,4343,4443-4446," +
+	"4449,4550,4567,4662,4848,4899-4900,4998,5000-5004,5009,5030,5033,5050-5051,5054,5060-5061," +
+	"5080,5087,5100-5102,5120,5190,5200,5214,5221-5222,5225-5226,5269,5280,5298,5357,5405,5414," +
+	"5431-5432,5440,5500,5510,5544,5550,5555,5560,5566,5631,5633,5666,5678-5679,5718,5730," +
+	"5800-5802,5810-5811,5815,5822,5825,5850,5859,5862,5877,5900-5904,5906-5907,5910-5911,5915," +
+	"5922,5925,5950,5952,5959-5963,5987-5989,5998-6007,6009,6025,6059,6100-6101,6106,6112,6123," +
+	"6129,6156,6346,6389,6502,6510,6543,6547,6565-6567,6580,6646,6666-6669,6689,6692,6699,6779," +
+	"6788-6789,6792,6839,6881,6901,6969,7000-7002,7004,7007,7019,7025,7070,7100,7103,7106," +
+	"7200-7201,7402,7435,7443,7496,7512,7625,7627,7676,7741,7777-7778,7800,7911,7920-7921," +
+	"7937-7938,7999-8002,8007-8011,8021-8022,8031,8042,8045,8080-8090,8093,8099-8100,8180-8181," +
+	"8192-8194,8200,8222,8254,8290-8292,8300,8333,8383,8400,8402,8443,8500,8600,8649,8651-8652," +
+	"8654,8701,8800,8873,8888,8899,8994,9000-9003,9009-9011,9040,9050,9071,9080-9081,9090-9091," +
+	"9099-9103,9110-9111,9200,9207,9220,9290,9415,9418,9485,9500,9502-9503,9535,9575,9593-9595," +
+	"9618,9666,9876-9878,9898,9900,9917,9929,9943-9944,9968,9998-10004,10009-10010,10012," +
+	"10024-10025,10082,10180,10215,10243,10566,10616-10617,10621,10626,10628-10629,10778," +
+	"11110-11111,11967,12000,12174,12265,12345,13456,13722,13782-13783,14000,14238,14441-14442," +
+	"15000,15002-15004,15660,15742,16000-16001,16012,16016,16018,16080,16113,16992-16993,17877," +
+	"17988,18040,18101,18988,19101,19283,19315,19350,19780,19801,19842,20000,20005,20031," +
+	"20221-20222,20828,21571,22939,23502,24444,24800,25734-25735,26214,27000,27352-27353," +
+	"27355-27356,27715,28201,30000,30718,30951,31038,31337,32768-32785,33354,33899,34571-34573," +
+	"35500,38292,40193,40911,41511,42510,44176,44442-44443,44501,45100,48080,49152-49161,49163," +
+	"49165,49167,49175-49176,49400,49999-50003,50006,50300,50389,50500,50636,50800,51103,51493," +
+	"52673,52822,52848,52869,54045,54328,55055-55056,55555,55600,56737-56738,57294,57797,58080," +
+	"60020,60443,61532,61900,62078,63331,64623,64680,65000,65129,65389"
+
+// serviceNames labels well-known ports.
+var serviceNames = map[int]string{
+	21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 53: "domain", 80: "http",
+	110: "pop3", 139: "netbios-ssn", 143: "imap", 443: "https", 445: "smb",
+	548: "afp", 554: "rtsp", 587: "submission", 631: "ipp", 993: "imaps",
+	995: "pop3s", 1883: "mqtt", 1900: "upnp", 3306: "mysql", 3389: "rdp",
+	5000: "upnp", 5353: "mdns", 5432: "postgresql", 5900: "vnc", 6379: "redis",
+	8000: "http-alt", 8008: "http-alt", 8009: "ajp13", 8080: "http-alt",
+	8123: "home-assistant", 8443: "https-alt", 8883: "mqtt-tls", 9100: "jetdirect",
+	32400: "plex", 62078: "iphone-sync",
+}
+
+// PortProfile returns the ports of a named profile: "quick", "common-1000" or
+// one of the custom profiles from the configuration.
+func PortProfile(name string, custom map[string][]string) ([]int, error) {
+	if specs, ok := custom[name]; ok {
+		return ParsePorts(specs)
+	}
+	switch name {
+	case "", "quick":
+		return ParsePorts(quickPorts)
+	case "common-1000":
+		return ParsePorts(strings.Split(common1000Ports, ","))
+	default:
+		return nil, fmt.Errorf("unknown port profile %q", name)
+	}
+}
+
+// ParsePorts expands entries like "22" or "8000-8100" into a sorted, de-duplicated list.
+func ParsePorts(specs []string) ([]int, error) {
+	seen := make(map[int]bool)
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		lo, hi := spec, spec
+		if i := strings.Index(spec, "-"); i != -1 {
+			lo, hi = spec[:i], spec[i+1:]
+		}
+		first, err1 := strconv.Atoi(lo)
+		last, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || first < 1 || last > 65535 || first > last {
+			return nil, fmt.Errorf("invalid port or range %q", spec)
+		}
+		for p := first; p <= last; p++ {
+			seen[p] = true
+		}
+	}
+
+	ports := make([]int, 0, len(seen))
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// SetConnectionBudget limits simultaneous TCP connection attempts across all hosts.
+func (s *Scanner) SetConnectionBudget(n int) {
+	if n <= 0 {
+		n = defaultConnectionsMax
+	}
+	s.connSem = make(chan struct{}, n)
+}
+
+// tcpProbe connects to the configured ports of every target, reading
+// banners and watching the SYN-ACKs for an OS fingerprint. The quick form
+// only checks the ports each device had open.
+type tcpProbe struct {
+	s           *Scanner
+	quick       bool
+	sniffFailed bool // No raw socket for SYN-ACKs; logged once
+}
+
+func (p *tcpProbe) Name() string { return EvidenceTCP }
+
+func (p *tcpProbe) Quick() Probe { return &tcpProbe{s: p.s, quick: true} }
+
+func (p *tcpProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	s := p.s
+	var sniffer *tcpSniffer
+	if !p.quick {
+		sniffer = p.sniffSYNACKs()
+	}
+
+	var wg sync.WaitGroup
+	// Limit concurrency to avoid flooding/system limits
+	sem := make(chan struct{}, 50)
+	list := make([]Observation, len(targets))
+	for i, ip := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+
+		go func(i int, ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if p.quick {
+				if ports := s.recheckPorts(ctx, ip); ports != nil {
+					list[i] = Observation{IP: ip, Answered: len(ports) > 0, Ports: ports}
+				}
+				return
+			}
+			ports := s.scanPorts(ctx, ip, s.PortList)
+			if len(ports) > 0 && s.Banners {
+				s.grabBanners(ctx, ip, ports)
+			}
+			if ports == nil {
+				// Probed with nothing open, which clears the device's ports
+				ports = []models.Port{}
+			}
+			list[i] = Observation{IP: ip, Answered: len(ports) > 0, Ports: ports}
+		}(i, ip)
+	}
+	wg.Wait()
+
+	// Hosts the quick form had no ports for were not probed
+	kept := list[:0]
+	for _, o := range list {
+		if o.IP != "" {
+			kept = append(kept, o)
+		}
+	}
+	list = kept
+
+	if sniffer != nil {
+		fingerprints := sniffer.stop()
+		for i := range list {
+			if fp, ok := fingerprints[list[i].IP]; ok {
+				list[i].Apply = func(dev *models.Device) { setTCPFingerprint(dev, fp) }
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return list, nil
+}
+
+// recheckPorts probes only the ports ip had open last time, keeping what was
+// learned about those still open. It returns nil if none were known.
+func (s *Scanner) recheckPorts(ctx context.Context, ip string) []models.Port {
+	s.mu.RLock()
+	var known []models.Port
+	if dev := s.deviceAt(ip); dev != nil {
+		known = append(known, dev.Ports...)
+	}
+	s.mu.RUnlock()
+	if len(known) == 0 {
+		return nil
+	}
+
+	numbers := make([]int, len(known))
+	for i, p := range known {
+		numbers[i] = p.Number
+	}
+	open := s.scanPorts(ctx, ip, numbers)
+	still := []models.Port{}
+	for _, p := range known {
+		for _, o := range open {
+			if o.Number == p.Number {
+				still = append(still, p)
+			}
+		}
+	}
+	return still
+}
+
+// scanPorts probes the given ports of one host concurrently, sharing the
+// scanner-wide connection budget with every other host being probed. No new
+// connections are started once ctx is done.
+func (s *Scanner) scanPorts(ctx context.Context, ip string, ports []int) []models.Port {
+	timeout := s.PortTimeout
+	if timeout <= 0 {
+		timeout = defaultPortTimeout
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		found []models.Port
+	)
+	dialer := net.Dialer{Timeout: timeout}
+ports:
+	for _, port := range ports {
+		select {
+		case s.connSem <- struct{}{}:
+		case <-ctx.Done():
+			break ports
+		}
+		wg.Add(1)
+
+		go func(port int) {
+			defer wg.Done()
+			defer func() { <-s.connSem }()
+
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+			if err != nil {
+				return
+			}
+			conn.Close()
+
+			mu.Lock()
+			found = append(found, models.Port{Number: port, Protocol: "tcp", Service: serviceNames[port]})
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Number < found[j].Number })
+	return found
+}
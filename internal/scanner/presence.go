@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Probe names used as presence evidence.
+const (
+	EvidenceARP  = "arp"
+	EvidenceICMP = "icmp"
+	EvidenceTCP  = "tcp"
+)
+
+// PresencePolicy decides which probe answers make a device count as online.
+type PresencePolicy struct {
+	Methods     []string // Probes that count as evidence, e.g. "arp", "icmp", "tcp"
+	MinEvidence int      // How many of them must answer (capped at the number that ran)
+}
+
+// DefaultPresencePolicy treats any single answer as proof of presence.
+func DefaultPresencePolicy() PresencePolicy {
+	return PresencePolicy{
+		Methods:     []string{EvidenceARP, EvidenceICMP, EvidenceTCP},
+		MinEvidence: 1,
+	}
+}
+
+// present reports whether the probes that answered satisfy the policy.
+// ran lists the probes actually attempted for this host, so a policy requiring
+// ARP does not mark hosts on routed networks offline forever: if none of the
+// policy's methods ran, any probe that answered counts.
+func (p PresencePolicy) present(ran []string, answered []string) bool {
+	counted, possible := 0, 0
+	for _, m := range p.Methods {
+		if contains(ran, m) {
+			possible++
+		}
+		if contains(answered, m) {
+			counted++
+		}
+	}
+	if possible == 0 {
+		return len(answered) > 0
+	}
+
+	needed := p.MinEvidence
+	if needed < 1 {
+		needed = 1
+	}
+	if needed > possible {
+		needed = possible
+	}
+	return counted >= needed
+}
+
+// icmpProbe pings every target.
+type icmpProbe struct {
+	failed bool // No ICMP socket could be opened; logged once
+}
+
+func (p *icmpProbe) Name() string { return EvidenceICMP }
+
+func (p *icmpProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	rtts := p.sweep(ctx, targets)
+	if rtts == nil {
+		return nil, nil
+	}
+	list := make([]Observation, 0, len(targets))
+	for _, ip := range targets {
+		rtt, ok := rtts[ip]
+		list = append(list, Observation{IP: ip, Answered: ok, RTT: rtt})
+	}
+	return list, nil
+}
+
+// sweep pings all targets. Failures to open a socket are logged once.
+func (p *icmpProbe) sweep(ctx context.Context, targets []string) map[string]time.Duration {
+	rtts, err := pingSweep(ctx, targets, pingTimeout)
+	if err != nil {
+		if !p.failed {
+			log.Printf("ICMP probing unavailable: %v", err)
+			p.failed = true
+		}
+		return nil
+	}
+	return rtts
+}
+
+// recordProbes stores round-trip time and presence evidence on a known device.
+func (s *Scanner) recordProbes(ip string, rtt time.Duration, evidence []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dev := s.deviceAt(ip); dev != nil {
+		dev.RTT = rtt
+		dev.Evidence = evidence
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"homenet/internal/models"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the built-in probes besides the presence probes (EvidenceARP,
+// EvidenceICMP and EvidenceTCP).
+const (
+	ProbeARPTable = "arp_table"
+	ProbeIPv6     = "ipv6"
+	ProbeMDNS     = NameMDNS
+	ProbeSSDP     = "ssdp"
+)
+
+// Probe is one way of discovering hosts. Run looks at the targets (it may
+// also report hosts outside them) and returns what it saw. Probes never touch
+// the device list; the scanner merges their observations into it.
+type Probe interface {
+	Name() string
+	Run(ctx context.Context, targets []string) ([]Observation, error)
+}
+
+// QuickProbe is implemented by probes with a cheaper form for liveness
+// checks, e.g. TCP probing only the ports a device had open.
+type QuickProbe interface {
+	Quick() Probe
+}
+
+// Observation is what a probe learned about one host.
+type Observation struct {
+	IP       string // IPv4 address, or IPv6 for hosts seen only over IPv6; empty to match by MAC
+	MAC      string
+	Answered bool // The host replied. Otherwise a presence probe got no answer, or a sighting only enriches known devices
+	Absent   bool // The host is certainly not there, so later probes skip it
+	RTT      time.Duration
+	Ports    []models.Port // Open ports; nil if the probe did not look
+	Name     string        // Hostname, recorded with the probe's name as its source
+	IPv6     []string      // Addresses to attach to the device
+
+	// Apply copies anything else the probe found onto the device.
+	// Called with the scanner locked.
+	Apply func(dev *models.Device)
+}
+
+// probeResult holds the observations of one probe run.
+type probeResult struct {
+	probe        string
+	observations []Observation
+}
+
+// observed is an observation tagged with the probe that made it.
+type observed struct {
+	probe string
+	Observation
+}
+
+// defaultProbes lists the built-in probes in the order they run. ARP goes
+// first so hosts silent on their own link are not port-scanned. They are
+// made once per scanner and only run on the scan goroutine, so the state they
+// keep between runs needs no lock.
+func (s *Scanner) defaultProbes() []Probe {
+	return []Probe{
+		&arpProbe{},
+		&icmpProbe{},
+		&tcpProbe{s: s},
+		arpTableProbe{},
+		&ipv6Probe{},
+		&mdnsProbe{s: s},
+		newSSDPProbe(s),
+	}
+}
+
+// AddProbe adds a discovery method, run after the built-in ones. Listing its
+// name in Presence.Methods lets its answers decide whether targets are online.
+func (s *Scanner) AddProbe(p Probe) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probes = append(s.probes, p)
+}
+
+// probeEnabled applies Disabled and the older per-protocol switches.
+func (s *Scanner) probeEnabled(name string) bool {
+	if contains(s.Disabled, name) {
+		return false
+	}
+	switch name {
+	case EvidenceARP:
+		return s.Method != "tcp"
+	case EvidenceICMP:
+		return s.ICMP
+	case ProbeIPv6:
+		return s.IPv6
+	case ProbeSSDP:
+		return s.SSDP
+	}
+	return true
+}
+
+// presenceProbe reports whether a probe's answers decide if a target is online.
+func (s *Scanner) presenceProbe(name string) bool {
+	return name == EvidenceARP || name == EvidenceICMP || name == EvidenceTCP || contains(s.Presence.Methods, name)
+}
+
+// runProbes runs every enabled probe in order, or for a quick scan only the
+// presence probes in their quick form. Hosts a probe reports absent are not
+// offered to the probes after it. A probe that fails is logged once and
+// skipped; nil is returned if ctx is cancelled.
+func (s *Scanner) runProbes(ctx context.Context, targets []string, quick bool) []probeResult {
+	s.mu.RLock()
+	probes := append([]Probe(nil), s.probes...)
+	s.mu.RUnlock()
+
+	var results []probeResult
+	live := targets
+	for _, p := range probes {
+		name := p.Name()
+		if !s.probeEnabled(name) || (quick && !s.presenceProbe(name)) {
+			continue
+		}
+		if q, ok := p.(QuickProbe); ok && quick {
+			p = q.Quick()
+		}
+		s.emitProgress(Progress{Scanning: true, Stage: name, Total: len(targets)})
+		list, err := p.Run(ctx, live)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			if !s.probeFailed[name] {
+				log.Printf("Probe %s unavailable: %v", name, err)
+				s.probeFailed[name] = true
+			}
+			continue
+		}
+		results = append(results, probeResult{probe: name, observations: list})
+
+		absent := make(map[string]bool)
+		for _, o := range list {
+			if o.Absent {
+				absent[o.IP] = true
+			}
+		}
+		if len(absent) > 0 {
+			var kept []string
+			for _, ip := range live {
+				if !absent[ip] {
+					kept = append(kept, ip)
+				}
+			}
+			live = kept
+		}
+	}
+	return results
+}
+
+// mergeObservations applies what the probes saw to the device list. Each
+// target is marked online or offline by the presence probes' answers; every
+// other sighting can add a device but never takes one offline.
+func (s *Scanner) mergeObservations(ctx context.Context, targets []string, results []probeResult) {
+	isTarget := make(map[string]bool, len(targets))
+	for _, ip := range targets {
+		isTarget[ip] = true
+	}
+	evidence := make(map[string][]observed)
+	var others []observed
+	now := time.Now()
+	s.mu.Lock()
+	for _, r := range results {
+		for _, o := range r.observations {
+			if s.presenceProbe(r.probe) && isTarget[o.IP] {
+				evidence[o.IP] = append(evidence[o.IP], observed{r.probe, o})
+			} else {
+				others = append(others, observed{r.probe, o})
+			}
+			if r.probe == ProbeMDNS && o.Answered && o.IP != "" {
+				s.mdnsHeard[o.IP] = now
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	// Name lookups are slow, so hosts are updated concurrently
+	var (
+		wg     sync.WaitGroup
+		probed atomic.Int32
+	)
+	sem := make(chan struct{}, 50)
+	for _, ip := range targets {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer func() {
+				s.emitProgress(Progress{Scanning: true, Total: len(targets), Probed: int(probed.Add(1))})
+			}()
+			s.mergeTarget(ip, evidence[ip])
+		}(ip)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Resolve names for rotated private MACs before locking
+	hostnames := make(map[string]string)
+	for _, sg := range others {
+		if name := s.rotationHostname(sg.IP, sg.MAC); name != "" {
+			hostnames[sg.IP] = name
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sg := range others {
+		s.mergeSighting(sg.probe, sg.Observation, hostnames[sg.IP])
+	}
+	s.expireIPv6Only(now)
+}
+
+// mergeTarget decides from the presence probes' answers whether the target
+// at ip is online, and records what they found. A recent mDNS answer counts
+// too, so hosts that ignore ARP and ping do not drop out between sweeps.
+func (s *Scanner) mergeTarget(ip string, sightings []observed) {
+	var (
+		ran, answered []string
+		mac           string
+		rtt           time.Duration
+		ports         []models.Port
+	)
+	for _, sg := range sightings {
+		ran = append(ran, sg.probe)
+		if sg.Answered {
+			answered = append(answered, sg.probe)
+		}
+		if sg.MAC != "" {
+			mac = sg.MAC
+		}
+		if sg.RTT > 0 {
+			rtt = sg.RTT
+		}
+		if sg.Ports != nil {
+			ports = sg.Ports
+		}
+	}
+
+	present := s.Presence.present(ran, answered)
+	if !present && !s.presenceProbe(ProbeMDNS) {
+		s.mu.RLock()
+		heard := s.heardMDNS(ip, time.Now())
+		s.mu.RUnlock()
+		if heard {
+			present = true
+			answered = append(answered, ProbeMDNS)
+		}
+	}
+
+	if present {
+		s.registerDevice(ip, mac, ports)
+		s.updateNames(ip)
+		s.recordProbes(ip, rtt, answered)
+	} else {
+		s.markOffline(ip)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dev := s.deviceAt(ip); dev != nil {
+		for _, sg := range sightings {
+			s.enrich(dev, sg.probe, sg.Observation)
+		}
+	}
+}
+
+// mergeSighting records an observation that does not decide presence. A host
+// that answered and is not known yet is added and marked online; known
+// devices are only enriched, except hosts known only by an IPv6 address,
+// which no presence probe covers. hostname is passed on to identify.
+// Callers hold s.mu.
+func (s *Scanner) mergeSighting(probe string, o Observation, hostname string) {
+	var dev *models.Device
+	switch {
+	case o.IP == "" && o.MAC != "":
+		dev = s.Devices[deviceID(o.MAC, "")]
+	case o.IP != "":
+		if ip := net.ParseIP(o.IP); ip == nil || (ip.To4() != nil && !s.inScope(o.IP)) {
+			return
+		}
+		dev = s.deviceAt(o.IP)
+		if o.MAC != "" {
+			if dev != nil && !dev.IsOnline && dev.MAC != "" && !strings.EqualFold(dev.MAC, o.MAC) {
+				// Stale entry for a device that has since left this address
+				return
+			}
+			s.checkBinding(o.IP, o.MAC, time.Now())
+		}
+		if o.Answered && (dev == nil || o.MAC != "") {
+			var isNew bool
+			dev, isNew = s.identify(o.IP, o.MAC, hostname)
+			if isNew {
+				dev.LastSeen = time.Now()
+				s.setOnline(dev, true)
+				if !s.firstScan {
+					label := probe
+					if o.Name != "" {
+						label = fmt.Sprintf("%s %s", probe, o.Name)
+					}
+					select {
+					case s.AlertChan <- fmt.Sprintf("NEW DEVICE: %s (%s)", o.IP, label):
+					default:
+					}
+				}
+			}
+		}
+		if o.Answered && dev != nil && dev.IP == o.IP && net.ParseIP(o.IP).To4() == nil {
+			dev.LastSeen = time.Now()
+			s.setOnline(dev, true)
+		}
+	}
+	if dev != nil {
+		s.enrich(dev, probe, o)
+	}
+}
+
+// enrich copies names, IPv6 addresses and probe-specific details onto dev.
+// Callers hold s.mu.
+func (s *Scanner) enrich(dev *models.Device, probe string, o Observation) {
+	if o.Name != "" && contains(s.NameSources, probe) {
+		s.setName(dev, probe, o.Name)
+	}
+	if len(o.IPv6) > 0 {
+		addIPv6(dev, o.IPv6, time.Now())
+	}
+	if o.Apply != nil {
+		o.Apply(dev)
+	}
+}
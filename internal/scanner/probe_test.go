@@ -0,0 +1,305 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"homenet/internal/models"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProbe returns canned observations and records the targets it was given.
+type fakeProbe struct {
+	name  string
+	seen  []string
+	list  []Observation
+	err   error
+	quick *fakeProbe
+}
+
+func (p *fakeProbe) Name() string { return p.name }
+
+func (p *fakeProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	p.seen = append([]string(nil), targets...)
+	return p.list, p.err
+}
+
+// quickFakeProbe is a fakeProbe with a cheaper form for liveness checks.
+type quickFakeProbe struct{ *fakeProbe }
+
+func (p quickFakeProbe) Quick() Probe { return p.quick }
+
+// newProbeScanner returns a scanner for 10.9.0.0/29 that runs only the given
+// probes, with name lookups limited to the fake probes so nothing touches
+// the network.
+func newProbeScanner(t *testing.T, probes ...Probe) *Scanner {
+	t.Helper()
+	s, err := NewScanner([]string{"10.9.0.0/29"}, nil, 0, filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	s.ARPWatch = false
+	s.DHCPCheck = 0
+	s.NameSources = []string{"first", "second", "sighting"}
+	s.Presence.Methods = []string{"first", "second"}
+	s.probes = probes
+	return s
+}
+
+func TestRunProbesSkipsAbsent(t *testing.T) {
+	first := &fakeProbe{name: "first", list: []Observation{
+		{IP: "10.9.0.1", Answered: true},
+		{IP: "10.9.0.2", Absent: true},
+	}}
+	second := &fakeProbe{name: "second"}
+	s := newProbeScanner(t, first, second)
+
+	results := s.runProbes(context.Background(), []string{"10.9.0.1", "10.9.0.2", "10.9.0.3"}, false)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if want := []string{"10.9.0.1", "10.9.0.3"}; !reflect.DeepEqual(second.seen, want) {
+		t.Errorf("second probe got targets %v, want %v", second.seen, want)
+	}
+}
+
+func TestRunProbesFailedAndDisabled(t *testing.T) {
+	failing := &fakeProbe{name: "first", err: errors.New("no permission")}
+	disabled := &fakeProbe{name: "disabled"}
+	second := &fakeProbe{name: "second", list: []Observation{{IP: "10.9.0.1", Answered: true}}}
+	s := newProbeScanner(t, failing, disabled, second)
+	s.Disabled = []string{"disabled"}
+
+	results := s.runProbes(context.Background(), []string{"10.9.0.1"}, false)
+	if len(results) != 1 || results[0].probe != "second" {
+		t.Fatalf("got results %+v, want only the second probe's", results)
+	}
+	if !s.probeFailed["first"] {
+		t.Error("failed probe not recorded")
+	}
+	if disabled.seen != nil {
+		t.Error("disabled probe ran")
+	}
+
+	// The devices answered by the remaining probe still come online
+	s.mergeObservations(context.Background(), []string{"10.9.0.1"}, results)
+	if dev := s.deviceAt("10.9.0.1"); dev == nil || !dev.IsOnline {
+		t.Errorf("device after failed probe = %+v, want online", dev)
+	}
+}
+
+func TestRunProbesQuick(t *testing.T) {
+	slow := &fakeProbe{name: "first"}
+	slow.quick = &fakeProbe{name: "first"}
+	other := &fakeProbe{name: "sighting"}
+	s := newProbeScanner(t, quickFakeProbe{slow}, other)
+
+	s.runProbes(context.Background(), []string{"10.9.0.1"}, true)
+	if slow.seen != nil || slow.quick.seen == nil {
+		t.Error("quick scan did not use the quick form of the probe")
+	}
+	if other.seen != nil {
+		t.Error("quick scan ran a probe that does not decide presence")
+	}
+}
+
+func TestMergePresenceProbes(t *testing.T) {
+	mac := "00:11:22:33:44:55"
+	ports := []models.Port{{Number: 22, Protocol: "tcp", Service: "SSH"}}
+	first := &fakeProbe{name: "first", list: []Observation{
+		{IP: "10.9.0.1", MAC: mac, Answered: true, RTT: 3 * time.Millisecond, Name: "first-name"},
+		{IP: "10.9.0.2"},
+	}}
+	second := &fakeProbe{name: "second", list: []Observation{
+		{IP: "10.9.0.1", Answered: true, RTT: 5 * time.Millisecond, Ports: ports, Name: "second-name"},
+		{IP: "10.9.0.2"},
+	}}
+	s := newProbeScanner(t, first, second)
+	targets := []string{"10.9.0.1", "10.9.0.2"}
+
+	s.mergeObservations(context.Background(), targets, s.runProbes(context.Background(), targets, false))
+
+	dev := s.deviceAt("10.9.0.1")
+	if dev == nil {
+		t.Fatal("answering target not added")
+	}
+	if dev.ID != deviceID(mac, "") || dev.MAC != mac {
+		t.Errorf("device keyed %s with MAC %s, want the MAC from the first probe", dev.ID, dev.MAC)
+	}
+	if !dev.IsOnline {
+		t.Error("answering target not online")
+	}
+	if dev.RTT != 5*time.Millisecond {
+		t.Errorf("RTT = %v, want the later probe's", dev.RTT)
+	}
+	if !reflect.DeepEqual(dev.Ports, ports) {
+		t.Errorf("ports = %v, want %v", dev.Ports, ports)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(dev.Evidence, want) {
+		t.Errorf("evidence = %v, want %v", dev.Evidence, want)
+	}
+	if dev.Hostname != "first-name" || dev.Names["second"] != "second-name" {
+		t.Errorf("hostname %q from names %v, want the preferred source's", dev.Hostname, dev.Names)
+	}
+	if s.deviceAt("10.9.0.2") != nil {
+		t.Error("silent target added")
+	}
+
+	// A later pass with no answers takes the device offline, keeping its ports
+	first.list = []Observation{{IP: "10.9.0.1"}}
+	second.list = []Observation{{IP: "10.9.0.1"}}
+	s.mergeObservations(context.Background(), targets, s.runProbes(context.Background(), targets, false))
+	if dev.IsOnline {
+		t.Error("device still online after no probe answered")
+	}
+	if !reflect.DeepEqual(dev.Ports, ports) {
+		t.Errorf("ports after offline pass = %v, want them kept", dev.Ports)
+	}
+}
+
+func TestMergeSightings(t *testing.T) {
+	sighting := &fakeProbe{name: "sighting"}
+	s := newProbeScanner(t, sighting)
+	s.registerDevice("10.9.0.1", "00:11:22:33:44:01", nil)
+	s.firstScan = false
+
+	applied := false
+	sighting.list = []Observation{
+		// Known device: enriched only
+		{IP: "10.9.0.1", Name: "printer", IPv6: []string{"fe80::1"}, Apply: func(dev *models.Device) { applied = true }},
+		// New host that answered: added and online
+		{IP: "10.9.0.5", MAC: "00:11:22:33:44:05", Answered: true, Name: "tv"},
+		// Unknown host that did not answer: ignored
+		{IP: "10.9.0.6", Name: "ghost"},
+		// Outside the scan ranges: ignored
+		{IP: "192.168.50.1", MAC: "00:11:22:33:44:07", Answered: true},
+	}
+	s.mergeObservations(context.Background(), nil, s.runProbes(context.Background(), nil, false))
+
+	known := s.deviceAt("10.9.0.1")
+	if known == nil || known.Hostname != "printer" || !reflect.DeepEqual(known.IPv6, []string{"fe80::1"}) || !applied {
+		t.Errorf("known device not enriched: %+v", known)
+	}
+	added := s.deviceAt("10.9.0.5")
+	if added == nil || !added.IsOnline || added.Hostname != "tv" {
+		t.Errorf("answered sighting = %+v, want an online device named tv", added)
+	}
+	if s.deviceAt("10.9.0.6") != nil {
+		t.Error("unanswered sighting added a device")
+	}
+	if s.deviceAt("192.168.50.1") != nil {
+		t.Error("out-of-scope sighting added a device")
+	}
+
+	select {
+	case alert := <-s.AlertChan:
+		if !strings.Contains(alert, "10.9.0.5") || !strings.Contains(alert, "sighting tv") {
+			t.Errorf("alert = %q, want the new device and its probe", alert)
+		}
+	default:
+		t.Error("no alert for the new device")
+	}
+}
+
+func TestMDNSAnswerKeepsHostOnline(t *testing.T) {
+	arp := &fakeProbe{name: "first", list: []Observation{{IP: "10.9.0.3"}}}
+	mdns := &fakeProbe{name: ProbeMDNS, list: []Observation{{IP: "10.9.0.3", Answered: true, Name: "phone"}}}
+	s := newProbeScanner(t, arp, mdns)
+	targets := []string{"10.9.0.3"}
+	pass := func(quick bool) {
+		s.mergeObservations(context.Background(), targets, s.runProbes(context.Background(), targets, quick))
+	}
+
+	pass(false)
+	dev := s.deviceAt("10.9.0.3")
+	if dev == nil || !dev.IsOnline {
+		t.Fatalf("host answering only mDNS = %+v, want online", dev)
+	}
+	if !contains(dev.Evidence, ProbeMDNS) {
+		t.Errorf("evidence = %v, want mdns", dev.Evidence)
+	}
+
+	// Liveness checks do not query mDNS; the recent answer still counts
+	pass(true)
+	if !dev.IsOnline {
+		t.Error("host went offline on a liveness check right after answering mDNS")
+	}
+
+	s.mdnsHeard["10.9.0.3"] = time.Now().Add(-s.mdnsFresh())
+	pass(true)
+	if dev.IsOnline {
+		t.Error("host still online with a stale mDNS answer")
+	}
+}
+
+func TestIPv6OnlyHostAgesOut(t *testing.T) {
+	mdns := &fakeProbe{name: ProbeMDNS, list: []Observation{{IP: "fd00::5", Answered: true, Name: "watch"}}}
+	s := newProbeScanner(t, mdns)
+	pass := func() {
+		s.mergeObservations(context.Background(), nil, s.runProbes(context.Background(), nil, false))
+	}
+
+	pass()
+	dev := s.deviceAt("fd00::5")
+	if dev == nil || !dev.IsOnline {
+		t.Fatalf("IPv6-only host = %+v, want online", dev)
+	}
+
+	mdns.list = nil
+	s.mu.Lock()
+	s.mdnsHeard["fd00::5"] = time.Now().Add(-s.mdnsFresh())
+	s.mu.Unlock()
+	pass()
+	if dev.IsOnline {
+		t.Error("IPv6-only host still online after its mDNS answer went stale")
+	}
+	if _, ok := s.mdnsHeard["fd00::5"]; ok {
+		t.Error("stale mDNS answer not forgotten")
+	}
+
+	mdns.list = []Observation{{IP: "fd00::5", Answered: true}}
+	pass()
+	if !dev.IsOnline {
+		t.Error("IPv6-only host not back online after answering again")
+	}
+}
+
+func TestMDNSFriendlyName(t *testing.T) {
+	s := newProbeScanner(t)
+	host := &mdnsHost{
+		name: "Kitchen-Speaker",
+		ipv4: []net.IP{net.ParseIP("10.9.0.4").To4()},
+		services: []models.MDNSService{
+			{Instance: "Kitchen@Kitchen-Speaker", Service: "_airplay._tcp"},
+			{Instance: "Kitchen speaker", Service: "_googlecast._tcp"},
+		},
+	}
+	o, ok := s.mdnsObservation(host)
+	if !ok {
+		t.Fatal("no observation for an in-range host")
+	}
+
+	dev := &models.Device{}
+	o.Apply(dev)
+	if dev.FriendlyName != "Kitchen" {
+		t.Errorf("friendly name = %q, want the first instance", dev.FriendlyName)
+	}
+
+	dev.FriendlyName = "Speaker (user)"
+	o.Apply(dev)
+	if dev.FriendlyName != "Speaker (user)" {
+		t.Errorf("friendly name = %q, want the user's kept", dev.FriendlyName)
+	}
+
+	host.services = nil
+	o, _ = s.mdnsObservation(host)
+	dev = &models.Device{}
+	o.Apply(dev)
+	if dev.FriendlyName != "Kitchen-Speaker" {
+		t.Errorf("friendly name = %q, want the host name", dev.FriendlyName)
+	}
+}
@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DefaultMaxHosts caps how many addresses a single range may contain (a /20).
+// Larger networks are refused rather than silently flooding them with probes.
+const DefaultMaxHosts = 4096
+
+// parseRanges turns CIDR strings into IPv4 networks. For compatibility the old
+// three-octet subnet form ("192.168.1") is read as a /24.
+func parseRanges(specs []string, maxHosts int) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if !strings.Contains(spec, "/") {
+			if strings.Count(spec, ".") == 2 {
+				spec += ".0/24"
+			} else {
+				spec += "/32"
+			}
+		}
+
+		_, ipnet, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scan range %q: %v", spec, err)
+		}
+		if ipnet.IP.To4() == nil {
+			return nil, fmt.Errorf("scan range %q: only IPv4 ranges can be swept", spec)
+		}
+		if maxHosts > 0 && rangeSize(ipnet) > uint64(maxHosts) {
+			return nil, fmt.Errorf("scan range %q has %d addresses, more than the limit of %d", spec, rangeSize(ipnet), maxHosts)
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+// detectRanges returns the IPv4 network of every up, non-loopback interface using
+// its real netmask. Networks larger than maxHosts are narrowed to the block of
+// that size around the interface address.
+func detectRanges(maxHosts int) []*net.IPNet {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var nets []*net.IPNet
+	seen := make(map[string]bool)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagPointToPoint != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			ones, bits := ipnet.Mask.Size()
+			if ones >= 31 {
+				continue
+			}
+			// Narrow huge networks (e.g. a /16) to something we can sweep
+			for maxHosts > 0 && uint64(1)<<uint(bits-ones) > uint64(maxHosts) {
+				ones++
+			}
+			mask := net.CIDRMask(ones, bits)
+			network := &net.IPNet{IP: ipnet.IP.To4().Mask(mask), Mask: mask}
+			if !seen[network.String()] {
+				seen[network.String()] = true
+				nets = append(nets, network)
+			}
+		}
+	}
+	return nets
+}
+
+// rangeSize returns the number of addresses in an IPv4 network.
+func rangeSize(n *net.IPNet) uint64 {
+	ones, bits := n.Mask.Size()
+	return uint64(1) << uint(bits-ones)
+}
+
+// hosts lists the usable host addresses of an IPv4 network. Network and
+// broadcast addresses are skipped except for /31 and /32 (RFC 3021).
+func hosts(n *net.IPNet) []net.IP {
+	ip4 := n.IP.To4()
+	if ip4 == nil {
+		return nil
+	}
+	ones, _ := n.Mask.Size()
+	start := binary.BigEndian.Uint32(ip4)
+	size := uint32(rangeSize(n))
+
+	first, last := start, start+size-1
+	if ones < 31 {
+		first++
+		last--
+	}
+
+	list := make([]net.IP, 0, last-first+1)
+	for v := first; ; v++ {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, v)
+		list = append(list, ip)
+		if v == last {
+			break
+		}
+	}
+	return list
+}
+
+// inRanges reports whether ip falls in any of the networks.
+func inRanges(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// targets returns every address to probe: all configured ranges minus exclusions.
+func (s *Scanner) targets() []string {
+	var list []string
+	seen := make(map[string]bool)
+	for _, n := range s.Ranges {
+		for _, ip := range hosts(n) {
+			if inRanges(ip, s.Exclude) {
+				continue
+			}
+			key := ip.String()
+			if !seen[key] {
+				seen[key] = true
+				list = append(list, key)
+			}
+		}
+	}
+	return list
+}
+
+// inScope reports whether an address (e.g. from the ARP table) belongs to the scanned ranges.
+func (s *Scanner) inScope(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	return inRanges(ip, s.Ranges) && !inRanges(ip, s.Exclude)
+}
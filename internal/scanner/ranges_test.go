@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		specs    []string
+		maxHosts int
+		want     []string
+		err      bool
+	}{
+		{name: "cidr", specs: []string{"192.168.1.0/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "host bits cleared", specs: []string{"192.168.1.77/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "legacy subnet", specs: []string{"192.168.1"}, want: []string{"192.168.1.0/24"}},
+		{name: "bare address", specs: []string{"10.0.0.5"}, want: []string{"10.0.0.5/32"}},
+		{name: "blank entries", specs: []string{"", " 10.0.0.0/31 "}, want: []string{"10.0.0.0/31"}},
+		{name: "at the limit", specs: []string{"10.0.0.0/20"}, maxHosts: 4096, want: []string{"10.0.0.0/20"}},
+		{name: "over the limit", specs: []string{"10.0.0.0/19"}, maxHosts: 4096, err: true},
+		{name: "no limit", specs: []string{"10.0.0.0/8"}, want: []string{"10.0.0.0/8"}},
+		{name: "ipv6", specs: []string{"fd00::/120"}, err: true},
+		{name: "garbage", specs: []string{"192.168.1.0/33"}, err: true},
+	} {
+		nets, err := parseRanges(tc.specs, tc.maxHosts)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: error = %v, want error %v", tc.name, err, tc.err)
+			continue
+		}
+		var got []string
+		for _, n := range nets {
+			got = append(got, n.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: ranges = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	for _, tc := range []struct {
+		cidr        string
+		count       int
+		first, last string
+	}{
+		{"192.168.1.0/24", 254, "192.168.1.1", "192.168.1.254"},
+		{"10.0.0.0/30", 2, "10.0.0.1", "10.0.0.2"},
+		// Point-to-point links use both addresses (RFC 3021)
+		{"10.0.0.0/31", 2, "10.0.0.0", "10.0.0.1"},
+		{"10.0.0.7/32", 1, "10.0.0.7", "10.0.0.7"},
+		{"255.255.255.252/30", 2, "255.255.255.253", "255.255.255.254"},
+	} {
+		_, n, _ := net.ParseCIDR(tc.cidr)
+		list := hosts(n)
+		if len(list) != tc.count || list[0].String() != tc.first || list[len(list)-1].String() != tc.last {
+			t.Errorf("hosts(%s) = %d addresses from %v to %v, want %d from %s to %s",
+				tc.cidr, len(list), list[0], list[len(list)-1], tc.count, tc.first, tc.last)
+		}
+	}
+}
+
+func TestTargetsExclude(t *testing.T) {
+	s, err := NewScanner([]string{"10.9.0.0/29", "10.9.0.4/30"}, []string{"10.9.0.2", "10.9.0.4/31"}, 0, filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	// Overlapping ranges list each address once
+	if want := []string{"10.9.0.1", "10.9.0.3", "10.9.0.6"}; !reflect.DeepEqual(s.targets(), want) {
+		t.Errorf("targets = %v, want %v", s.targets(), want)
+	}
+	if s.inScope("10.9.0.2") || s.inScope("10.9.0.5") || !s.inScope("10.9.0.6") || s.inScope("10.9.1.1") {
+		t.Error("inScope disagrees with the ranges and exclusions")
+	}
+
+	if _, err := NewScanner([]string{"10.0.0.0/16"}, nil, 0, filepath.Join(t.TempDir(), "devices.json")); err == nil {
+		t.Error("a /16 was accepted over the default host limit")
+	}
+}
@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"homenet/internal/models"
@@ -13,106 +14,240 @@ import (
 	"time"
 )
 
+// Progress reports how far the current scan has come.
+type Progress struct {
+	Scanning bool
+	Stage    string // Probe running, or "" once hosts are being updated
+	Probed   int    // Hosts updated so far
+	Total    int    // Hosts in this sweep
+}
+
 // Scanner handles network discovery.
 type Scanner struct {
-	Devices     map[string]*models.Device
-	mu          sync.RWMutex
-	Subnet      string
-	AlertChan   chan string // Channel to send alert messages
-	firstScan   bool
-	devicesFile string
+	Devices       map[string]*models.Device // Keyed by device ID
+	byIP          map[string]string         // Current IP to device ID
+	mu            sync.RWMutex
+	Ranges        []*net.IPNet  // IPv4 networks to sweep
+	Exclude       []*net.IPNet  // Addresses never probed
+	AlertChan     chan string   // Channel to send alert messages
+	ProgressChan  chan Progress // Latest scan progress; stale updates are dropped
+	Method        string        // "arp" (ARP sweep with TCP fallback) or "tcp"
+	ICMP          bool          // Ping every target as an extra presence probe
+	Presence      PresencePolicy
+	Schedule      SchedulePolicy
+	probes        []Probe              // Discovery methods, run in order
+	probeFailed   map[string]bool      // Probes whose error was logged; only touched by the scan goroutine
+	Disabled      []string             // Names of probes to skip
+	Vendors       *VendorDB            // MAC prefix to manufacturer
+	Classifier    *Classifier          // Rules deciding each device's type
+	History       *History             // Online/offline transitions per device
+	SSDP          bool                 // Discover UPnP devices with M-SEARCH
+	DHCPSnoop     bool                 // Listen for DHCP requests on UDP 67 (needs root, off by default)
+	IPv6          bool                 // Ping ff02::1 and read the IPv6 neighbor table
+	ARPWatch      bool                 // Raise security alerts on suspicious IP/MAC bindings
+	MaxIPsPerMAC  int                  // More addresses than this behind one MAC is an alert
+	bindings      *bindingWatch        // Recent IP/MAC sightings checked by ARPWatch
+	DHCPCheck     time.Duration        // How often to look for rogue DHCP servers; 0, the default, disables
+	TrustedDHCP   []string             // IPs or MACs of legitimate DHCP servers; empty trusts the gateway
+	PortList      []int                // TCP ports probed on every host
+	PortTimeout   time.Duration        // Per-connection timeout
+	Banners       bool                 // Grab service banners from open ports
+	OSFingerprint bool                 // Guess the OS from SYN-ACKs seen while probing ports
+	NameSources   []string             // Hostname sources, most preferred first
+	namesChecked  map[string]time.Time // Device ID to when its names were last looked up
+	lastChecked   map[string]time.Time // Device ID to its last liveness check
+	connSem       chan struct{}
+	firstScan     bool
+	devicesFile   string
+	warnings      []models.SecurityAlert       // Oldest first
+	dhcpServers   map[string]models.DHCPServer // Server IP to its last offer
+	dhcpPending   map[string]pendingDHCP       // Normalized client MAC to its REQUEST awaiting an answer
+	mdnsHeard     map[string]time.Time         // Address to when it last answered mDNS
+	saveMu        sync.Mutex                   // Serializes writes of devicesFile
+	cancel        context.CancelFunc           // Stops the running scanner; nil when stopped
+	workers       sync.WaitGroup               // Scan loop, DHCP listeners and rogue DHCP check
+	trigger       chan struct{}                // ScanNow requests, at most one pending
 }
 
 // NewScanner creates a new Scanner instance.
-// If subnet is empty, it attempts to auto-detect.
-func NewScanner(subnet string, devicesFile string) *Scanner {
-	if subnet == "" {
-		subnet = detectSubnet()
+// ranges and exclude are CIDRs (e.g. "192.168.0.0/22"); if ranges is empty,
+// each interface's network is auto-detected. Ranges with more than maxHosts
+// addresses are rejected (0 uses DefaultMaxHosts).
+func NewScanner(ranges []string, exclude []string, maxHosts int, devicesFile string) (*Scanner, error) {
+	if maxHosts <= 0 {
+		maxHosts = DefaultMaxHosts
+	}
+	nets, err := parseRanges(ranges, maxHosts)
+	if err != nil {
+		return nil, err
 	}
+	if len(nets) == 0 {
+		nets = detectRanges(maxHosts)
+	}
+	if len(nets) == 0 {
+		_, fallback, _ := net.ParseCIDR("192.168.1.0/24")
+		nets = []*net.IPNet{fallback}
+	}
+	excluded, err := parseRanges(exclude, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Scanner{
 		Devices:     make(map[string]*models.Device),
-		Subnet:      subnet,
+		byIP:        make(map[string]string),
+		Ranges:      nets,
+		Exclude:     excluded,
 		AlertChan:   make(chan string, 10),
+		ProgressChan: make(chan Progress, 1),
+		trigger:     make(chan struct{}, 1),
+		Method:      "arp",
+		ICMP:        true,
+		Presence:    DefaultPresencePolicy(),
+		Schedule:    DefaultSchedulePolicy(),
+		Vendors:     NewVendorDB(),
+		Classifier:  NewClassifier(),
+		History:     LoadHistory("", 0),
+		SSDP:        true,
+		IPv6:        true,
+		ARPWatch:    true,
+		MaxIPsPerMAC: 4,
+		bindings:    newBindingWatch(),
+		dhcpServers: make(map[string]models.DHCPServer),
+		dhcpPending: make(map[string]pendingDHCP),
+		mdnsHeard:   make(map[string]time.Time),
+		NameSources: DefaultNameSources(),
+		namesChecked: make(map[string]time.Time),
+		lastChecked: make(map[string]time.Time),
+		PortTimeout: defaultPortTimeout,
+		Banners:     true,
+		OSFingerprint: true,
+		connSem:     make(chan struct{}, defaultConnectionsMax),
+		probeFailed: make(map[string]bool),
 		firstScan:   true,
 		devicesFile: devicesFile,
 	}
+	s.PortList, _ = PortProfile("quick", nil)
+	s.probes = s.defaultProbes()
 	s.LoadDevices()
-	return s
+	return s, nil
 }
 
-func detectSubnet() string {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "192.168.1" // Fallback
-	}
-	for _, a := range addrs {
-		if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				// Return the first 3 octets: "192.168.100"
-				ip := ipnet.IP.String()
-				parts := strings.Split(ip, ".")
-				if len(parts) == 4 {
-					return strings.Join(parts[:3], ".")
-				}
-			}
-		}
+// Start scans in the background right away and then as Schedule says, until
+// ctx is cancelled or Stop is called. Settings may be changed between Stop
+// and the next Start.
+func (s *Scanner) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
 	}
-	return "192.168.1"
-}
+	ctx, s.cancel = context.WithCancel(ctx)
 
-// Start begins the scanning process in the background.
-func (s *Scanner) Start(interval time.Duration) {
+	if s.DHCPSnoop {
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.snoopDHCP(ctx)
+		}()
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.watchDHCPReplies(ctx)
+		}()
+	}
+	if s.DHCPCheck > 0 {
+		interval := s.DHCPCheck
+		s.workers.Add(1)
+		go func() {
+			defer s.workers.Done()
+			s.watchDHCPServers(ctx, interval)
+		}()
+	}
+	s.workers.Add(1)
 	go func() {
-		for {
-			s.scan()
-			time.Sleep(interval)
-		}
+		defer s.workers.Done()
+		s.run(ctx)
 	}()
 }
 
-// scan iterates through the subnet IPs and attempts to connect.
-func (s *Scanner) scan() {
-	var wg sync.WaitGroup
-	// Limit concurrency to avoid flooding/system limits
-	sem := make(chan struct{}, 50)
-
-	for i := 1; i < 255; i++ {
-		ip := fmt.Sprintf("%s.%d", s.Subnet, i)
-		wg.Add(1)
-		sem <- struct{}{}
-
-		go func(targetIP string) {
-			defer wg.Done()
-			defer func() { <-sem }()
-			
-			openPorts := s.scanPorts(targetIP)
-			if len(openPorts) > 0 {
-				s.registerDevice(targetIP, openPorts)
-			} else {
-				s.markOffline(targetIP)
-			}
-		}(ip)
-	}
-	wg.Wait()
-	
-	// After scanning IPs, check local ARP table for MACs
-	s.updateARP()
-	
-	// Check for mDNS services to get friendly names
-	s.scanMDNS()
+// Stop cancels the running scan and waits for the background work to end.
+func (s *Scanner) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		s.workers.Wait()
+	}
+}
+
+// ScanNow asks for a full sweep without waiting for the schedule. Requests
+// made while a scan runs are merged into a single follow-up sweep.
+func (s *Scanner) ScanNow() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// emitProgress replaces any update the TUI has not read yet.
+func (s *Scanner) emitProgress(p Progress) {
+	select {
+	case <-s.ProgressChan:
+	default:
+	}
+	select {
+	case s.ProgressChan <- p:
+	default:
+	}
+}
+
+// scan runs the probes against targets and merges what they found. A quick
+// scan is a liveness check: only the presence probes run, in their cheapest
+// form. A cancelled ctx stops it between hosts and phases.
+func (s *Scanner) scan(ctx context.Context, targets []string, quick bool) {
+	if quick && len(targets) == 0 {
+		return
+	}
+	s.emitProgress(Progress{Scanning: true, Total: len(targets)})
+	defer s.emitProgress(Progress{Scanning: false, Total: len(targets), Probed: len(targets)})
+
+	if s.ARPWatch {
+		s.updateGateways()
+	}
+
+	results := s.runProbes(ctx, targets, quick)
+	if ctx.Err() != nil {
+		return
+	}
+	s.mergeObservations(ctx, targets, results)
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Weigh everything learned into a device type
+	s.classifyAll()
 	
 	// Save state
 	s.SaveDevices()
+	s.History.Save()
 
+	s.mu.Lock()
 	s.firstScan = false
+	s.mu.Unlock()
 }
 
 // SaveDevices writes the current device list to a JSON file atomically.
 func (s *Scanner) SaveDevices() {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
 
+	s.mu.RLock()
 	data, err := json.MarshalIndent(s.Devices, "", "  ")
+	s.mu.RUnlock()
 	if err != nil {
 		fmt.Printf("Error marshaling devices: %v\n", err)
 		return
@@ -148,11 +283,20 @@ func (s *Scanner) LoadDevices() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	err = json.Unmarshal(data, &s.Devices)
+	var devices map[string]*models.Device
+	err = json.Unmarshal(data, &devices)
 	if err != nil {
 		fmt.Printf("Error loading devices: %v\n", err)
 		return
 	}
+
+	// Older versions keyed devices by IP; keep a copy before converting
+	var migrated bool
+	s.Devices, migrated = migrateDevices(devices)
+	if migrated {
+		_ = os.WriteFile(s.devicesFile+".bak", data, 0644)
+	}
+	s.reindex()
 	
 	// Mark all loaded devices as offline initially until scanned
 	for _, dev := range s.Devices {
@@ -160,64 +304,82 @@ func (s *Scanner) LoadDevices() {
 	}
 }
 
-// scanPorts checks a list of common ports
-func (s *Scanner) scanPorts(ip string) []string {
-	// Common ports to check
-	ports := map[string]string{
-		"80": "HTTP", "443": "HTTPS", "22": "SSH", "53": "DNS", 
-		"8080": "HTTP-ALT", "62078": "iOS-Sync", "5353": "mDNS",
-		"3389": "RDP", "5000": "UPnP", "8000": "HTTP-ALT",
+// registerDevice records a device answering at ip. mac is empty when the
+// host was not reached over ARP, ports nil when its ports were not probed.
+func (s *Scanner) registerDevice(ip string, mac string, ports []models.Port) {
+	hostname := s.rotationHostname(ip, mac)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mac != "" {
+		s.checkBinding(ip, mac, time.Now())
 	}
-	
-	var found []string
-	for port, name := range ports {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%s", ip, port), 200*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			found = append(found, name)
-			// For MVP, if we find one, we consider it online. 
-			// But we'll try to find all in this list.
+	dev, isNew := s.identify(ip, mac, hostname)
+	// Alert if not first scan
+	if isNew && !s.firstScan {
+		select {
+		case s.AlertChan <- fmt.Sprintf("NEW DEVICE: %s", ip):
+		default:
 		}
 	}
-	return found
+	dev.LastSeen = time.Now()
+	s.setOnline(dev, true)
+	if ports != nil {
+		dev.Ports = ports
+	}
 }
 
-func (s *Scanner) registerDevice(ip string, ports []string) {
+func (s *Scanner) markOffline(ip string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	
+	if dev := s.deviceAt(ip); dev != nil {
+		s.setOnline(dev, false)
+	}
+}
 
-	dev, exists := s.Devices[ip]
-	if !exists {
-		dev = &models.Device{
-			IP: ip,
-		}
-		// Try to resolve hostname
-		names, _ := net.LookupAddr(ip)
-		if len(names) > 0 {
-			dev.Hostname = strings.TrimSuffix(names[0], ".")
-		}
-		s.Devices[ip] = dev
-
-		// Alert if not first scan
-		if !s.firstScan {
-			select {
-			case s.AlertChan <- fmt.Sprintf("NEW DEVICE: %s", ip):
-			default:
-			}
+// SetVendors replaces the vendor database and relabels known devices.
+func (s *Scanner) SetVendors(db *VendorDB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Vendors = db
+	for _, dev := range s.Devices {
+		if dev.MAC != "" {
+			dev.Manufacturer = db.Lookup(dev.MAC)
 		}
 	}
-	dev.LastSeen = time.Now()
-	dev.IsOnline = true
-	dev.Ports = ports
 }
 
-func (s *Scanner) markOffline(ip string) {
+// SetHistory replaces the presence history. Devices the history still
+// shows as online (the app was stopped while they were up) are closed off
+// at the time they were last seen.
+func (s *Scanner) SetHistory(h *History) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
-	if dev, exists := s.Devices[ip]; exists {
-		dev.IsOnline = false
+
+	s.History = h
+	for id, dev := range s.Devices {
+		if !dev.IsOnline && h.Online(id) {
+			h.Record(id, false, dev.LastSeen)
+		}
+	}
+}
+
+// setOnline changes a device's state and records the transition.
+// Callers hold s.mu.
+func (s *Scanner) setOnline(dev *models.Device, online bool) {
+	if dev.IsOnline == online {
+		return
 	}
+	dev.IsOnline = online
+	s.History.Record(dev.ID, online, time.Now())
+}
+
+// PresenceSummary returns uptime, sessions and timeline for a device.
+func (s *Scanner) PresenceSummary(id string) models.PresenceSummary {
+	return s.History.Summary(id, time.Now())
 }
 
 // GetDevices returns a list of current devices.
@@ -227,21 +389,62 @@ func (s *Scanner) GetDevices() []models.Device {
 	
 	list := make([]models.Device, 0, len(s.Devices))
 	for _, dev := range s.Devices {
-		list = append(list, *dev)
+		list = append(list, cloneDevice(dev))
 	}
 	return list
 }
 
-// updateARP enriches devices with MAC addresses from local ARP table.
-func (s *Scanner) updateARP() {
+// cloneDevice copies a device deeply enough that the scanner can keep
+// updating the original while the caller reads the copy.
+func cloneDevice(dev *models.Device) models.Device {
+	c := *dev
+	c.Ports = append([]models.Port(nil), dev.Ports...)
+	c.MDNSServices = append([]models.MDNSService(nil), dev.MDNSServices...)
+	c.IPv6 = append([]string(nil), dev.IPv6...)
+	if dev.IPv6Seen != nil {
+		c.IPv6Seen = make(map[string]time.Time, len(dev.IPv6Seen))
+		for k, v := range dev.IPv6Seen {
+			c.IPv6Seen[k] = v
+		}
+	}
+	c.UPnPServices = append([]string(nil), dev.UPnPServices...)
+	c.Evidence = append([]string(nil), dev.Evidence...)
+	c.TypeEvidence = append([]string(nil), dev.TypeEvidence...)
+	c.IPHistory = append([]models.IPLease(nil), dev.IPHistory...)
+	c.PreviousMACs = append([]string(nil), dev.PreviousMACs...)
+	if dev.Names != nil {
+		c.Names = make(map[string]string, len(dev.Names))
+		for k, v := range dev.Names {
+			c.Names[k] = v
+		}
+	}
+	return c
+}
+
+// arpTableProbe reads MAC addresses from the local ARP table, adding hosts
+// that never answered our probes (passive discovery).
+type arpTableProbe struct{}
+
+func (arpTableProbe) Name() string { return ProbeARPTable }
+
+func (arpTableProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	var list []Observation
+	observe := func(ip string, mac string) {
+		if deviceID(mac, ip) == "ip-"+ip {
+			// Incomplete entry (00:00:00:00:00:00)
+			return
+		}
+		list = append(list, Observation{IP: ip, MAC: mac, Answered: true})
+	}
 	if runtime.GOOS == "linux" {
-		s.updateARPLinux()
+		readARPLinux(observe)
 	} else if runtime.GOOS == "windows" {
-		s.updateARPWindows()
+		readARPWindows(observe)
 	}
+	return list, nil
 }
 
-func (s *Scanner) updateARPLinux() {
+func readARPLinux(observe func(ip string, mac string)) {
 	content, err := os.ReadFile("/proc/net/arp")
 	if err != nil {
 		return 
@@ -256,27 +459,11 @@ func (s *Scanner) updateARPLinux() {
 		ip := fields[0]
 		mac := fields[3]
 		
-		if strings.HasPrefix(ip, s.Subnet) {
-			s.mu.Lock()
-			if dev, ok := s.Devices[ip]; ok {
-				dev.MAC = mac
-				dev.Manufacturer = getManuf(mac)
-			} else {
-				// Passive discovery via ARP
-				s.Devices[ip] = &models.Device{
-					IP:           ip,
-					MAC:          mac,
-					Manufacturer: getManuf(mac),
-					LastSeen:     time.Now(),
-					IsOnline:     true,
-				}
-			}
-			s.mu.Unlock()
-		}
+		observe(ip, mac)
 	}
 }
 
-func (s *Scanner) updateARPWindows() {
+func readARPWindows(observe func(ip string, mac string)) {
 	out, err := exec.Command("arp", "-a").Output()
 	if err != nil {
 		return
@@ -293,53 +480,6 @@ func (s *Scanner) updateARPWindows() {
 		ip := fields[0]
 		mac := strings.ReplaceAll(fields[1], "-", ":") // Normalize to colons
 
-		if strings.HasPrefix(ip, s.Subnet) {
-			s.mu.Lock()
-			if dev, ok := s.Devices[ip]; ok {
-				dev.MAC = mac
-				dev.Manufacturer = getManuf(mac)
-			} else {
-				// Passive discovery via ARP
-				s.Devices[ip] = &models.Device{
-					IP:           ip,
-					MAC:          mac,
-					Manufacturer: getManuf(mac),
-					LastSeen:     time.Now(),
-					IsOnline:     true,
-				}
-			}
-			s.mu.Unlock()
-		}
-	}
-}
-
-// Simple OUI lookup (Top 20 common vendors)
-func getManuf(mac string) string {
-	if len(mac) < 8 {
-		return ""
-	}
-	oui := strings.ToUpper(mac[:8])
-	
-	// This is a tiny sample. A full list is >5MB.
-	vendors := map[string]string{
-		"DC:A6:32": "Raspberry Pi", "B8:27:EB": "Raspberry Pi", "D8:3A:DD": "Raspberry Pi",
-		"00:1A:2B": "Cisco",
-		"F0:9E:63": "Apple", "BC:D1:D3": "Apple", "00:03:93": "Apple", "00:17:F2": "Apple",
-		"AC:29:3A": "Canon",
-		"44:38:39": "Cumulus",
-		"50:E5:49": "Gigabyte",
-		"00:11:32": "Synology",
-		"24:8D:76": "Espressif", "84:F3:EB": "Espressif", // IoT chips
-		"00:50:56": "VMware",
-		"00:0C:29": "VMware",
-		"52:54:00": "QEMU/KVM",
-	}
-	
-	// Fallback: Check just the first 3 bytes/chars if exact match failed?
-	// ARP MACs in linux are usually xx:xx:xx:xx:xx:xx
-	
-	if name, ok := vendors[oui]; ok {
-		return name
+		observe(ip, mac)
 	}
-	return ""
 }
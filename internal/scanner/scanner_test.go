@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestScanner returns a scanner confined to the loopback address, with
+// the listeners and multicast probes that need a real network turned off.
+func newTestScanner(t *testing.T) *Scanner {
+	t.Helper()
+	s, err := NewScanner([]string{"127.0.0.1/32"}, nil, 0, filepath.Join(t.TempDir(), "devices.json"))
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	s.DHCPSnoop = false
+	s.DHCPCheck = 0
+	s.ICMP = false
+	s.Disabled = []string{ProbeMDNS, ProbeSSDP, ProbeIPv6}
+	s.PortTimeout = 50 * time.Millisecond
+	s.Schedule.Liveness = 10 * time.Millisecond
+	return s
+}
+
+func TestScannerLifecycle(t *testing.T) {
+	s := newTestScanner(t)
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.GetDevices()
+			}
+		}
+	}()
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.ProgressChan:
+			}
+		}
+	}()
+
+	s.Start(context.Background())
+	s.Start(context.Background()) // Already running; must be a no-op
+	for i := 0; i < 5; i++ {
+		s.ScanNow()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	s.Stop() // Stopping twice is harmless
+
+	// The scanner can be started again after Stop
+	s.Start(context.Background())
+	s.ScanNow()
+	s.Stop()
+
+	close(done)
+	readers.Wait()
+}
+
+func TestScannerStopsWithContext(t *testing.T) {
+	s := newTestScanner(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	s.ScanNow()
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Stop did not return after the context was cancelled")
+	}
+}
+
+// scanPorts must not start new connections once its context is done.
+func TestScanPortsCancelled(t *testing.T) {
+	s := newTestScanner(t)
+	s.SetConnectionBudget(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ports := make([]int, 1000)
+	for i := range ports {
+		ports[i] = 20000 + i
+	}
+	start := time.Now()
+	s.scanPorts(ctx, "127.0.0.1", ports)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled scan took %v", elapsed)
+	}
+	if n := len(s.connSem); n != 0 {
+		t.Errorf("%d connection slots still held", n)
+	}
+}
+
+// silentServer accepts connections on n loopback ports and never writes, so
+// each banner grab waits out its full timeout. It reports every accept.
+func silentServer(t *testing.T, n int) ([]int, <-chan struct{}) {
+	t.Helper()
+	accepted := make(chan struct{}, 100)
+	var ports []int
+	for i := 0; i < n; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		ports = append(ports, ln.Addr().(*net.TCPAddr).Port)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				t.Cleanup(func() { conn.Close() })
+				select {
+				case accepted <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	return ports, accepted
+}
+
+func TestStopDuringScan(t *testing.T) {
+	s := newTestScanner(t)
+	ports, accepted := silentServer(t, 3)
+	s.PortList = ports
+	s.Banners = true
+
+	s.Start(context.Background())
+	// One connection per port finds them open; the next is a banner grab,
+	// which alone would hold the scan for bannerTimeout per port
+	for i := 0; i < len(ports)+1; i++ {
+		select {
+		case <-accepted:
+		case <-time.After(10 * time.Second):
+			t.Fatal("scan never reached the banner grab")
+		}
+	}
+
+	start := time.Now()
+	s.Stop()
+	if elapsed := time.Since(start); elapsed > bannerTimeout/2 {
+		t.Errorf("Stop took %v during a banner grab", elapsed)
+	}
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SchedulePolicy decides when the scanner runs and how much it probes.
+// Liveness checks ask only the presence probes about known devices, with TCP
+// limited to the ports each had open; full sweeps run every probe against
+// every address to find new devices.
+type SchedulePolicy struct {
+	Liveness      time.Duration // Between liveness checks
+	FullSweep     time.Duration // Between full sweeps
+	MaxBackoff    time.Duration // Longest gap between checks of a device that has been offline a long time
+	QuietStart    time.Duration // Start of quiet hours as an offset from local midnight
+	QuietEnd      time.Duration // End of quiet hours; equal to QuietStart for none
+	QuietLiveness time.Duration // Between liveness checks in quiet hours, when no full sweeps run
+}
+
+// DefaultSchedulePolicy checks known devices every 30 seconds and sweeps for
+// new ones every 10 minutes, without quiet hours.
+func DefaultSchedulePolicy() SchedulePolicy {
+	return SchedulePolicy{
+		Liveness:      30 * time.Second,
+		FullSweep:     10 * time.Minute,
+		MaxBackoff:    time.Hour,
+		QuietLiveness: 5 * time.Minute,
+	}
+}
+
+// withDefaults fills in intervals left at zero.
+func (p SchedulePolicy) withDefaults() SchedulePolicy {
+	def := DefaultSchedulePolicy()
+	if p.Liveness <= 0 {
+		p.Liveness = def.Liveness
+	}
+	if p.FullSweep <= 0 {
+		p.FullSweep = def.FullSweep
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = def.MaxBackoff
+	}
+	if p.QuietLiveness <= 0 {
+		p.QuietLiveness = def.QuietLiveness
+	}
+	return p
+}
+
+// ParseQuietHours reads a local time window such as "23:00-07:00". An empty
+// spec means no quiet hours.
+func ParseQuietHours(spec string) (start time.Duration, end time.Duration, err error) {
+	if strings.TrimSpace(spec) == "" {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("quiet hours %q: want HH:MM-HH:MM", spec)
+	}
+	if start, err = parseClock(from); err == nil {
+		end, err = parseClock(to)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("quiet hours %q: %v", spec, err)
+	}
+	return start, end, nil
+}
+
+// parseClock turns "07:30" into its offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// quiet reports whether t falls in quiet hours. The window may span midnight.
+func (p SchedulePolicy) quiet(t time.Time) bool {
+	if p.QuietStart == p.QuietEnd {
+		return false
+	}
+	h, m, sec := t.Clock()
+	now := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second
+	if p.QuietStart < p.QuietEnd {
+		return now >= p.QuietStart && now < p.QuietEnd
+	}
+	return now >= p.QuietStart || now < p.QuietEnd
+}
+
+// next returns when the next pass is due and whether it is a full sweep.
+// The first pass is always a full sweep, even in quiet hours.
+func (p SchedulePolicy) next(lastFull time.Time, lastCheck time.Time, now time.Time) (time.Time, bool) {
+	if lastFull.IsZero() {
+		return now, true
+	}
+	if p.quiet(now) {
+		return lastCheck.Add(p.QuietLiveness), false
+	}
+	fullAt := lastFull.Add(p.FullSweep)
+	checkAt := lastCheck.Add(p.Liveness)
+	if !fullAt.After(checkAt) {
+		return fullAt, true
+	}
+	return checkAt, false
+}
+
+// backoff returns how long to wait between liveness checks of a device that
+// has been offline for the given time: the liveness interval, doubled while
+// it stays under a quarter of the time offline, up to MaxBackoff.
+func (p SchedulePolicy) backoff(offline time.Duration) time.Duration {
+	wait := p.Liveness
+	for wait*2 <= offline/4 && wait < p.MaxBackoff {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// run scans on the schedule until ctx is done. ScanNow requests a full
+// sweep straight away, in quiet hours too.
+func (s *Scanner) run(ctx context.Context) {
+	policy := s.Schedule.withDefaults()
+	var lastFull, lastCheck time.Time
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		at, full := policy.next(lastFull, lastCheck, time.Now())
+		timer.Reset(time.Until(at))
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.trigger:
+			full = true
+		}
+		timer.Stop()
+
+		if full {
+			s.scan(ctx, s.targets(), false)
+			lastFull = time.Now()
+		} else {
+			s.scan(ctx, s.livenessTargets(policy, time.Now()), true)
+		}
+		lastCheck = time.Now()
+	}
+}
+
+// livenessTargets lists the addresses of known devices to check, leaving out
+// offline devices whose backoff has not passed yet at now.
+func (s *Scanner) livenessTargets(policy SchedulePolicy, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []string
+	for id, dev := range s.Devices {
+		if !s.inScope(dev.IP) {
+			continue
+		}
+		if !dev.IsOnline && now.Sub(s.lastChecked[id]) < policy.backoff(now.Sub(dev.LastSeen)) {
+			continue
+		}
+		s.lastChecked[id] = now
+		list = append(list, dev.IP)
+	}
+	return list
+}
@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// clock returns the given time of day on a fixed date.
+func clock(h, m int) time.Time {
+	return time.Date(2026, 3, 1, h, m, 0, 0, time.Local)
+}
+
+func TestParseQuietHours(t *testing.T) {
+	for _, tc := range []struct {
+		spec       string
+		start, end time.Duration
+		err        bool
+	}{
+		{spec: ""},
+		{spec: "  "},
+		{spec: "23:00-07:00", start: 23 * time.Hour, end: 7 * time.Hour},
+		{spec: " 22:30 - 06:15 ", start: 22*time.Hour + 30*time.Minute, end: 6*time.Hour + 15*time.Minute},
+		{spec: "09:00-17:00", start: 9 * time.Hour, end: 17 * time.Hour},
+		{spec: "23:00", err: true},
+		{spec: "25:00-07:00", err: true},
+		{spec: "23:00-7pm", err: true},
+	} {
+		start, end, err := ParseQuietHours(tc.spec)
+		if (err != nil) != tc.err || start != tc.start || end != tc.end {
+			t.Errorf("ParseQuietHours(%q) = %v, %v, %v; want %v, %v, error %v", tc.spec, start, end, err, tc.start, tc.end, tc.err)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	overnight := SchedulePolicy{QuietStart: 23 * time.Hour, QuietEnd: 7 * time.Hour}
+	daytime := SchedulePolicy{QuietStart: 9 * time.Hour, QuietEnd: 17 * time.Hour}
+	for _, tc := range []struct {
+		name   string
+		policy SchedulePolicy
+		at     time.Time
+		want   bool
+	}{
+		{"none", SchedulePolicy{}, clock(3, 0), false},
+		{"overnight before", overnight, clock(22, 59), false},
+		{"overnight start", overnight, clock(23, 0), true},
+		{"overnight after midnight", overnight, clock(3, 0), true},
+		{"overnight last second", overnight, clock(7, 0).Add(-time.Second), true},
+		{"overnight end", overnight, clock(7, 0), false},
+		{"overnight midday", overnight, clock(12, 0), false},
+		{"daytime inside", daytime, clock(12, 0), true},
+		{"daytime before", daytime, clock(8, 59), false},
+		{"daytime end", daytime, clock(17, 0), false},
+	} {
+		if got := tc.policy.quiet(tc.at); got != tc.want {
+			t.Errorf("%s: quiet(%s) = %v, want %v", tc.name, tc.at.Format("15:04:05"), got, tc.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	p := SchedulePolicy{
+		Liveness:      30 * time.Second,
+		FullSweep:     10 * time.Minute,
+		QuietStart:    23 * time.Hour,
+		QuietEnd:      7 * time.Hour,
+		QuietLiveness: 5 * time.Minute,
+	}
+	for _, tc := range []struct {
+		name                string
+		lastFull, lastCheck time.Time
+		now                 time.Time
+		wantAt              time.Time
+		wantFull            bool
+	}{
+		{"first pass", time.Time{}, time.Time{}, clock(12, 0), clock(12, 0), true},
+		{"first pass in quiet hours", time.Time{}, time.Time{}, clock(3, 0), clock(3, 0), true},
+		{"liveness check", clock(12, 0), clock(12, 5), clock(12, 5), clock(12, 5).Add(30 * time.Second), false},
+		{"full sweep due first", clock(12, 0), clock(12, 9).Add(45 * time.Second), clock(12, 9).Add(45 * time.Second), clock(12, 10), true},
+		{"quiet hours", clock(22, 50), clock(0, 58), clock(1, 0), clock(1, 3), false},
+	} {
+		at, full := p.next(tc.lastFull, tc.lastCheck, tc.now)
+		if !at.Equal(tc.wantAt) || full != tc.wantFull {
+			t.Errorf("%s: next = %s, full %v; want %s, full %v", tc.name, at.Format("15:04:05"), full, tc.wantAt.Format("15:04:05"), tc.wantFull)
+		}
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	p := SchedulePolicy{Liveness: 30 * time.Second, MaxBackoff: time.Hour}
+	for _, tc := range []struct {
+		offline time.Duration
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{time.Minute, 30 * time.Second},
+		{4 * time.Minute, time.Minute},
+		{10 * time.Minute, 2 * time.Minute},
+		{2 * time.Hour, 16 * time.Minute},
+		{24 * time.Hour, time.Hour},
+		{30 * 24 * time.Hour, time.Hour},
+	} {
+		if got := p.backoff(tc.offline); got != tc.want {
+			t.Errorf("backoff(%v) = %v, want %v", tc.offline, got, tc.want)
+		}
+	}
+}
+
+func TestLivenessTargets(t *testing.T) {
+	s := newProbeScanner(t)
+	policy := SchedulePolicy{Liveness: 30 * time.Second, MaxBackoff: time.Hour}
+	now := clock(12, 0)
+
+	s.registerDevice("10.9.0.1", "00:11:22:33:44:01", nil)
+	s.registerDevice("10.9.0.2", "00:11:22:33:44:02", nil)
+	s.registerDevice("10.9.0.3", "00:11:22:33:44:03", nil)
+	online, gone, recent := s.deviceAt("10.9.0.1"), s.deviceAt("10.9.0.2"), s.deviceAt("10.9.0.3")
+	online.IsOnline = true
+	// Offline a day, checked half an hour ago: waits out its hour
+	gone.IsOnline, gone.LastSeen = false, now.Add(-24*time.Hour)
+	s.lastChecked[gone.ID] = now.Add(-30 * time.Minute)
+	// Offline two minutes, checked a minute ago: due after 30 seconds
+	recent.IsOnline, recent.LastSeen = false, now.Add(-2*time.Minute)
+	s.lastChecked[recent.ID] = now.Add(-time.Minute)
+
+	got := s.livenessTargets(policy, now)
+	sort.Strings(got)
+	if want := []string{"10.9.0.1", "10.9.0.3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+
+	// Ten seconds on, the offline device just checked waits again
+	if got := s.livenessTargets(policy, now.Add(10*time.Second)); !reflect.DeepEqual(got, []string{"10.9.0.1"}) {
+		t.Errorf("targets = %v, want only the online device", got)
+	}
+
+	// Once its hour is up the long-gone device is asked again
+	got = s.livenessTargets(policy, now.Add(30*time.Minute))
+	sort.Strings(got)
+	if want := []string{"10.9.0.1", "10.9.0.2", "10.9.0.3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("targets = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+package scanner
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"homenet/internal/models"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	bindingWindow = 30 * time.Minute // How far back IP/MAC sightings are compared
+	gatewayTrust  = 24 * time.Hour   // A new gateway MAC is accepted once the old one is gone this long
+	alertRepeat   = time.Hour        // The same anomaly is reported at most this often
+	maxWarnings   = 100
+)
+
+type sighting struct {
+	mac string
+	at  time.Time
+}
+
+type gatewayBinding struct {
+	mac      string
+	lastSeen time.Time
+}
+
+// bindingWatch remembers recent IP to MAC bindings to spot ARP spoofing.
+type bindingWatch struct {
+	ipMACs   map[string][]sighting           // Recent MAC changes per IP
+	macIPs   map[string]map[string]time.Time // IPs each MAC was seen at, and when
+	gateways map[string]*gatewayBinding      // Default gateway IP to its expected MAC
+	raised   map[string]time.Time            // Alert key to when it was last reported
+}
+
+func newBindingWatch() *bindingWatch {
+	return &bindingWatch{
+		ipMACs:   make(map[string][]sighting),
+		macIPs:   make(map[string]map[string]time.Time),
+		gateways: make(map[string]*gatewayBinding),
+		raised:   make(map[string]time.Time),
+	}
+}
+
+// updateGateways refreshes which addresses are default gateways. Expected
+// MACs already learned are kept.
+func (s *Scanner) updateGateways() {
+	gateways := defaultGateways()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ip := range gateways {
+		if _, ok := s.bindings.gateways[ip]; ok {
+			continue
+		}
+		gw := &gatewayBinding{}
+		// Start from the MAC stored with the device, so a spoof right after a
+		// restart is still noticed
+		if dev := s.deviceAt(ip); dev != nil && dev.MAC != "" {
+			gw.mac, gw.lastSeen = strings.ToLower(dev.MAC), dev.LastSeen
+		}
+		s.bindings.gateways[ip] = gw
+	}
+}
+
+// checkBinding records that ip answered from mac at now and raises an alert
+// when that looks like spoofing. Callers hold s.mu.
+func (s *Scanner) checkBinding(ip string, mac string, now time.Time) {
+	if !s.ARPWatch || deviceID(mac, ip) == "ip-"+ip {
+		return
+	}
+	mac = strings.ToLower(mac)
+	w := s.bindings
+
+	// The gateway answering from a different MAC
+	if gw, ok := w.gateways[ip]; ok {
+		switch {
+		case gw.mac == "" || gw.mac == mac:
+			gw.mac, gw.lastSeen = mac, now
+		case now.Sub(gw.lastSeen) > gatewayTrust:
+			// The old router has been gone for a day: it was replaced
+			log.Printf("Gateway %s now at %s (was %s)", ip, mac, gw.mac)
+			gw.mac, gw.lastSeen = mac, now
+		default:
+			s.raise(models.AlertGatewaySpoof, ip, []string{gw.mac, mac},
+				fmt.Sprintf("Gateway %s answered from %s instead of %s", ip, mac, gw.mac), now)
+		}
+	}
+
+	// An IP switching back and forth between MACs
+	history := w.ipMACs[ip]
+	for len(history) > 0 && now.Sub(history[0].at) > bindingWindow {
+		history = history[1:]
+	}
+	if len(history) == 0 || history[len(history)-1].mac != mac {
+		history = append(history, sighting{mac: mac, at: now})
+	}
+	w.ipMACs[ip] = history
+	if len(history) >= 3 {
+		var macs []string
+		for _, h := range history {
+			if !contains(macs, h.mac) {
+				macs = append(macs, h.mac)
+			}
+		}
+		s.raise(models.AlertIPConflict, ip, macs,
+			fmt.Sprintf("%s switched MAC %d times in %s: %s", ip, len(history)-1, bindingWindow, strings.Join(macs, ", ")), now)
+	}
+
+	// One MAC answering for many IPs
+	ips := w.macIPs[mac]
+	if ips == nil {
+		ips = make(map[string]time.Time)
+		w.macIPs[mac] = ips
+	}
+	ips[ip] = now
+	for other, at := range ips {
+		if now.Sub(at) > bindingWindow {
+			delete(ips, other)
+		}
+	}
+	if s.MaxIPsPerMAC > 0 && len(ips) > s.MaxIPsPerMAC {
+		s.raise(models.AlertMACMultiIP, "", []string{mac},
+			fmt.Sprintf("%s answered for %d addresses", mac, len(ips)), now)
+	}
+}
+
+// raise stores a security alert seen at now and shows it, unless the same
+// anomaly was reported within alertRepeat. Callers hold s.mu.
+func (s *Scanner) raise(kind string, ip string, macs []string, message string, now time.Time) {
+	key := kind + "|" + ip + "|" + strings.Join(macs, ",")
+	if last, ok := s.bindings.raised[key]; ok && now.Sub(last) < alertRepeat {
+		return
+	}
+	s.bindings.raised[key] = now
+
+	log.Printf("Security: %s", message)
+	s.warnings = append(s.warnings, models.SecurityAlert{Kind: kind, IP: ip, MACs: macs, Message: message, At: now})
+	if len(s.warnings) > maxWarnings {
+		s.warnings = s.warnings[len(s.warnings)-maxWarnings:]
+	}
+	select {
+	case s.AlertChan <- "SECURITY: " + message:
+	default:
+	}
+}
+
+// Warnings returns the security alerts raised so far, newest first.
+func (s *Scanner) Warnings() []models.SecurityAlert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]models.SecurityAlert, len(s.warnings))
+	for i, w := range s.warnings {
+		list[len(list)-1-i] = w
+	}
+	return list
+}
+
+// defaultGateways lists the IPv4 default routes' next hops.
+func defaultGateways() []string {
+	switch runtime.GOOS {
+	case "linux":
+		return gatewaysLinux()
+	case "windows":
+		return gatewaysWindows()
+	}
+	return nil
+}
+
+func gatewaysLinux() []string {
+	content, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	var list []string
+	for _, line := range strings.Split(string(content), "\n") {
+		// Iface Destination Gateway Flags ...; addresses in host byte order
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+		if !ip.IsUnspecified() && !contains(list, ip.String()) {
+			list = append(list, ip.String())
+		}
+	}
+	return list
+}
+
+func gatewaysWindows() []string {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return nil
+	}
+	var list []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// Network Destination  Netmask  Gateway  Interface  Metric
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		if ip := net.ParseIP(fields[2]); ip != nil && ip.To4() != nil && !contains(list, fields[2]) {
+			list = append(list, fields[2])
+		}
+	}
+	return list
+}
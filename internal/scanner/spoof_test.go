@@ -0,0 +1,170 @@
+package scanner
+
+import (
+	"homenet/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	macA = "aa:aa:aa:00:00:01"
+	macB = "aa:aa:aa:00:00:02"
+)
+
+// see reports one IP/MAC sighting at the given time.
+func see(s *Scanner, ip string, mac string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkBinding(ip, mac, at)
+}
+
+// alertKinds lists the kinds of the alerts raised so far, oldest first.
+func alertKinds(s *Scanner) []string {
+	var kinds []string
+	for _, a := range s.Warnings() {
+		kinds = append([]string{a.Kind}, kinds...)
+	}
+	return kinds
+}
+
+func TestGatewaySpoof(t *testing.T) {
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name  string
+		after time.Duration // From the last sighting of the known MAC to the other one
+		want  []string
+	}{
+		{"other MAC right away", time.Minute, []string{models.AlertGatewaySpoof}},
+		{"other MAC within a day", gatewayTrust, []string{models.AlertGatewaySpoof}},
+		{"router replaced", gatewayTrust + time.Second, nil},
+	} {
+		s := newTestScanner(t)
+		s.bindings.gateways["192.168.1.1"] = &gatewayBinding{}
+		see(s, "192.168.1.1", macA, t0)
+		see(s, "192.168.1.1", macA, t0.Add(time.Hour))
+		see(s, "192.168.1.1", macB, t0.Add(time.Hour+tc.after))
+
+		if got := alertKinds(s); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got alerts %q, want %q", tc.name, got, tc.want)
+		}
+		if tc.want != nil {
+			if a := s.Warnings()[0]; a.IP != "192.168.1.1" || !reflect.DeepEqual(a.MACs, []string{macA, macB}) {
+				t.Errorf("%s: got alert for %s %q, want the gateway with both MACs", tc.name, a.IP, a.MACs)
+			}
+		} else if mac := s.bindings.gateways["192.168.1.1"].mac; mac != macB {
+			t.Errorf("%s: expected gateway MAC %s, want %s", tc.name, mac, macB)
+		}
+	}
+}
+
+func TestGatewayIgnoresOtherHosts(t *testing.T) {
+	s := newTestScanner(t)
+	s.bindings.gateways["192.168.1.1"] = &gatewayBinding{}
+	t0 := time.Now()
+	see(s, "192.168.1.1", macA, t0)
+	see(s, "192.168.1.20", macB, t0)
+	see(s, "192.168.1.1", "AA:AA:AA:00:00:01", t0.Add(time.Minute))
+	if got := alertKinds(s); got != nil {
+		t.Errorf("got alerts %q, want none", got)
+	}
+}
+
+func TestIPFlips(t *testing.T) {
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	type seen struct {
+		mac   string
+		after time.Duration
+	}
+	for _, tc := range []struct {
+		name  string
+		seen  []seen
+		alert bool
+	}{
+		{"one change", []seen{{macA, 0}, {macB, 5 * time.Minute}}, false},
+		{"same MAC again", []seen{{macA, 0}, {macA, time.Minute}, {macA, 2 * time.Minute}, {macB, 3 * time.Minute}}, false},
+		{"back and forth", []seen{{macA, 0}, {macB, 5 * time.Minute}, {macA, 10 * time.Minute}}, true},
+		{"three MACs", []seen{{macA, 0}, {macB, time.Minute}, {"aa:aa:aa:00:00:03", 2 * time.Minute}}, true},
+		{"last flip at the window's edge", []seen{{macA, 0}, {macB, 20 * time.Minute}, {macA, bindingWindow}}, true},
+		{"flips spread out", []seen{{macA, 0}, {macB, 20 * time.Minute}, {macA, bindingWindow + time.Second}}, false},
+	} {
+		s := newTestScanner(t)
+		for _, sg := range tc.seen {
+			see(s, "192.168.1.20", sg.mac, t0.Add(sg.after))
+		}
+		got := alertKinds(s)
+		if tc.alert && !reflect.DeepEqual(got, []string{models.AlertIPConflict}) {
+			t.Errorf("%s: got alerts %q, want one IP conflict", tc.name, got)
+		}
+		if !tc.alert && got != nil {
+			t.Errorf("%s: got alerts %q, want none", tc.name, got)
+		}
+	}
+}
+
+func TestMACOnManyIPs(t *testing.T) {
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	ips := []string{"192.168.1.10", "192.168.1.11", "192.168.1.12", "192.168.1.13", "192.168.1.14"}
+	for _, tc := range []struct {
+		name  string
+		max   int
+		ips   int
+		step  time.Duration // Between sightings
+		alert bool
+	}{
+		{"at the limit", 4, 4, time.Minute, false},
+		{"over the limit", 4, 5, time.Minute, true},
+		{"over the limit in a lower setting", 2, 3, time.Minute, true},
+		{"first address expired", 4, 5, bindingWindow/4 + time.Second, false},
+		{"check turned off", 0, 5, time.Minute, false},
+	} {
+		s := newTestScanner(t)
+		s.MaxIPsPerMAC = tc.max
+		for i, ip := range ips[:tc.ips] {
+			see(s, ip, macA, t0.Add(time.Duration(i)*tc.step))
+		}
+		got := alertKinds(s)
+		if tc.alert && !reflect.DeepEqual(got, []string{models.AlertMACMultiIP}) {
+			t.Errorf("%s: got alerts %q, want one MAC on many IPs", tc.name, got)
+		}
+		if !tc.alert && got != nil {
+			t.Errorf("%s: got alerts %q, want none", tc.name, got)
+		}
+	}
+}
+
+func TestAlertRepeat(t *testing.T) {
+	s := newTestScanner(t)
+	s.bindings.gateways["192.168.1.1"] = &gatewayBinding{}
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	see(s, "192.168.1.1", macA, t0)
+	see(s, "192.168.1.1", macB, t0.Add(time.Minute))
+	see(s, "192.168.1.1", macB, t0.Add(2*time.Minute))
+	if got := len(s.Warnings()); got != 1 {
+		t.Errorf("within %s: got %d alerts, want 1", alertRepeat, got)
+	}
+	see(s, "192.168.1.1", macB, t0.Add(time.Minute+alertRepeat))
+	if got := len(s.Warnings()); got != 2 {
+		t.Errorf("after %s: got %d alerts, want 2", alertRepeat, got)
+	}
+}
+
+func TestBindingsNeedARPWatch(t *testing.T) {
+	s := newTestScanner(t)
+	s.ARPWatch = false
+	s.bindings.gateways["192.168.1.1"] = &gatewayBinding{}
+	t0 := time.Now()
+	see(s, "192.168.1.1", macA, t0)
+	see(s, "192.168.1.1", macB, t0)
+	see(s, "192.168.1.1", macA, t0)
+	if got := alertKinds(s); got != nil {
+		t.Errorf("got alerts %q with ARPWatch off, want none", got)
+	}
+
+	// Without a usable MAC there is nothing to compare
+	s.ARPWatch = true
+	see(s, "192.168.1.1", "00:00:00:00:00:00", t0)
+	if mac := s.bindings.gateways["192.168.1.1"].mac; mac != "" {
+		t.Errorf("learned gateway MAC %q from a zero MAC, want none", mac)
+	}
+}
@@ -0,0 +1,224 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"homenet/internal/models"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ssdpAddr        = "239.255.255.250:1900"
+	ssdpWait        = 3 * time.Second // MX plus some slack
+	ssdpRefresh     = time.Hour       // How often a description is fetched again
+	ssdpMaxDescBody = 256 << 10
+)
+
+// upnpDevice is the <device> element of a UPnP description document.
+type upnpDevice struct {
+	DeviceType   string        `xml:"deviceType"`
+	FriendlyName string        `xml:"friendlyName"`
+	Manufacturer string        `xml:"manufacturer"`
+	ModelName    string        `xml:"modelName"`
+	ModelNumber  string        `xml:"modelNumber"`
+	Services     []upnpService `xml:"serviceList>service"`
+	Devices      []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+}
+
+type upnpRoot struct {
+	Device upnpDevice `xml:"device"`
+}
+
+// ssdpProbe sends an M-SEARCH and reads the description of every UPnP device
+// that answers, to learn its name, maker and model. Descriptions only enrich
+// devices already discovered via scan/ARP.
+type ssdpProbe struct {
+	s       *Scanner
+	fetched map[string]time.Time // Description URL to when it was last read; guarded by s.mu
+}
+
+func newSSDPProbe(s *Scanner) *ssdpProbe {
+	return &ssdpProbe{s: s, fetched: make(map[string]time.Time)}
+}
+
+func (p *ssdpProbe) Name() string { return ProbeSSDP }
+
+func (p *ssdpProbe) Run(ctx context.Context, targets []string) ([]Observation, error) {
+	s := p.s
+	locations := searchSSDP(ctx, ssdpWait)
+	var list []Observation
+
+	for ip, location := range locations {
+		if ctx.Err() != nil {
+			break
+		}
+		if !s.inScope(ip) {
+			continue
+		}
+		s.mu.RLock()
+		fetched, seen := p.fetched[location]
+		s.mu.RUnlock()
+		if seen && time.Since(fetched) < ssdpRefresh {
+			continue
+		}
+
+		root, err := fetchDescription(ctx, ip, location)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("UPnP description from %s: %v", ip, err)
+			}
+			continue
+		}
+		list = append(list, p.observation(ip, location, root))
+	}
+	return list, nil
+}
+
+// observation carries a description to the device at ip. The fetch only
+// counts once the description has landed on a device; a host not yet
+// discovered is asked again next scan. Apply runs with s.mu held.
+func (p *ssdpProbe) observation(ip, location string, root *upnpRoot) Observation {
+	return Observation{IP: ip, Apply: func(dev *models.Device) {
+		applyUPnP(dev, root)
+		p.fetched[location] = time.Now()
+	}}
+}
+
+// searchSSDP multicasts an M-SEARCH for all devices and returns the
+// description URL each responding address advertised within wait, or
+// before ctx is done.
+func searchSSDP(ctx context.Context, wait time.Duration) map[string]string {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		log.Printf("SSDP discovery unavailable: %v", err)
+		return nil
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	dst, _ := net.ResolveUDPAddr("udp4", ssdpAddr)
+	msg := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+	// UDP may drop a datagram; a second copy is customary
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteTo([]byte(msg), dst); err != nil {
+			log.Printf("SSDP discovery unavailable: %v", err)
+			return nil
+		}
+	}
+
+	locations := make(map[string]string)
+	conn.SetReadDeadline(time.Now().Add(wait))
+	buf := make([]byte, 2048)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Read deadline reached or socket closed
+			return locations
+		}
+		addr, ok := peer.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		// A device announces one location per embedded device; the root one comes first
+		if loc := resp.Header.Get("Location"); loc != "" {
+			if _, dup := locations[addr.IP.String()]; !dup {
+				locations[addr.IP.String()] = loc
+			}
+		}
+	}
+}
+
+// fetchDescription downloads and parses a UPnP description. The URL must
+// point back at the address that answered, so a device cannot make us
+// fetch from elsewhere.
+func fetchDescription(ctx context.Context, ip string, location string) (*upnpRoot, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() != ip || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("location %s is not on the responding host", location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var root upnpRoot
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, ssdpMaxDescBody)).Decode(&root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// applyUPnP copies what the description says onto a device.
+func applyUPnP(dev *models.Device, root *upnpRoot) {
+	d := root.Device
+
+	name := strings.TrimSpace(d.FriendlyName)
+	if name != "" && (dev.FriendlyName == "" || dev.FriendlyName == dev.Hostname) {
+		dev.FriendlyName = name
+	}
+	if m := strings.TrimSpace(d.Manufacturer); m != "" && (dev.Manufacturer == "" || dev.Manufacturer == PrivateAddress) {
+		dev.Manufacturer = m
+	}
+	if d.ModelName != "" {
+		dev.ModelName = strings.TrimSpace(d.ModelName)
+	}
+	if d.ModelNumber != "" {
+		dev.ModelNumber = strings.TrimSpace(d.ModelNumber)
+	}
+	dev.UPnPType = d.DeviceType
+	if i := strings.Index(d.DeviceType, ":device:"); i != -1 {
+		dev.UPnPType = d.DeviceType[i+len(":device:"):]
+	}
+	dev.UPnPServices = upnpServices(d, nil)
+}
+
+// upnpServices lists the short service names of a device and its embedded
+// devices, e.g. "AVTransport:1".
+func upnpServices(d upnpDevice, list []string) []string {
+	for _, svc := range d.Services {
+		name := svc.ServiceType
+		if i := strings.Index(name, ":service:"); i != -1 {
+			name = name[i+len(":service:"):]
+		}
+		if name != "" && !contains(list, name) {
+			list = append(list, name)
+		}
+	}
+	for _, child := range d.Devices {
+		list = upnpServices(child, list)
+	}
+	return list
+}
@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+    <friendlyName>Living Room TV</friendlyName>
+    <manufacturer>Acme</manufacturer>
+  </device>
+</root>`
+
+func TestSSDPFetchCountsOnlyWhenApplied(t *testing.T) {
+	const location = "http://10.9.0.3:8008/desc.xml"
+	var root upnpRoot
+	root.Device.FriendlyName = "Living Room TV"
+	ssdp := &fakeProbe{name: ProbeSSDP}
+	s := newProbeScanner(t, ssdp)
+	fetcher := newSSDPProbe(s)
+	ssdp.list = []Observation{fetcher.observation("10.9.0.3", location, &root)}
+	pass := func() {
+		s.mergeObservations(context.Background(), nil, s.runProbes(context.Background(), nil, false))
+	}
+
+	// Nothing known at the address yet, so the description must be read again
+	pass()
+	if _, ok := fetcher.fetched[location]; ok {
+		t.Fatal("fetch recorded without a device to apply it to")
+	}
+
+	s.registerDevice("10.9.0.3", "00:11:22:33:44:03", nil)
+	pass()
+	if _, ok := fetcher.fetched[location]; !ok {
+		t.Error("fetch not recorded after the description was applied")
+	}
+	if dev := s.deviceAt("10.9.0.3"); dev.FriendlyName != "Living Room TV" {
+		t.Errorf("friendly name = %q, want the description's", dev.FriendlyName)
+	}
+}
+
+func TestFetchDescription(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testDescription))
+	}))
+	defer srv.Close()
+	host, _, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	location := srv.URL + "/desc.xml"
+
+	root, err := fetchDescription(context.Background(), host, location)
+	if err != nil {
+		t.Fatalf("fetchDescription: %v", err)
+	}
+	if root.Device.FriendlyName != "Living Room TV" || root.Device.Manufacturer != "Acme" {
+		t.Errorf("description = %+v", root.Device)
+	}
+
+	// The location must point back at the host that answered
+	if _, err := fetchDescription(context.Background(), "10.9.0.3", location); err == nil {
+		t.Error("fetched a description from another host")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fetchDescription(ctx, host, location); err == nil {
+		t.Error("fetched a description after the context was cancelled")
+	}
+}
@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"fmt"
+	"homenet/internal/models"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/ipv4"
+)
+
+// osSourceTCP marks an OS guess taken from a SYN-ACK.
+const osSourceTCP = "tcp"
+
+// tcpSignature describes how a TCP stack answers a SYN. Window is 0 for
+// any; Options is the option layout, e.g. "M,N,W,S,T".
+type tcpSignature struct {
+	OS      string
+	TTL     int
+	Window  int
+	Options string
+}
+
+// tcpSignatures is the bundled SYN-ACK signature database, most specific
+// entries first. Signatures assume a SYN offering MSS, SACK, timestamps and
+// window scaling, which is what the OS dialer sends.
+var tcpSignatures = []tcpSignature{
+	{OS: "Linux", TTL: 64, Window: 65160, Options: "M,S,T,N,W"},
+	{OS: "Linux", TTL: 64, Window: 28960, Options: "M,S,T,N,W"},
+	{OS: "Linux (old kernel)", TTL: 64, Window: 14480, Options: "M,S,T,N,W"},
+	{OS: "Linux (old kernel)", TTL: 64, Window: 5792, Options: "M,S,T,N,W"},
+	{OS: "Linux", TTL: 64, Options: "M,S,T,N,W"},
+	{OS: "Linux", TTL: 64, Options: "M,N,N,S,N,W"},
+	{OS: "Darwin (macOS/iOS)", TTL: 64, Window: 65535, Options: "M,N,W,N,N,T,S,E"},
+	{OS: "Darwin (macOS/iOS)", TTL: 64, Options: "M,N,W,N,N,T,S,E"},
+	{OS: "FreeBSD", TTL: 64, Window: 65535, Options: "M,N,W,S,T"},
+	{OS: "Windows", TTL: 128, Window: 65535, Options: "M,N,W,S,T"},
+	{OS: "Windows", TTL: 128, Window: 8192, Options: "M,N,W,S,T"},
+	{OS: "Windows", TTL: 128, Options: "M,N,W,S,T"},
+	{OS: "Windows", TTL: 128, Options: "M,N,W,N,N,S"},
+	{OS: "Windows", TTL: 128, Options: "M,N,W,N,N,T,N,N,S"},
+	{OS: "Windows (XP or older)", TTL: 128, Options: "M,N,N,S"},
+	{OS: "Cisco IOS", TTL: 255, Window: 4128, Options: "M"},
+	{OS: "Embedded (lwIP)", TTL: 255, Options: "M"},
+	{OS: "Embedded (lwIP)", TTL: 64, Window: 5840, Options: "M"},
+	{OS: "Embedded (lwIP)", TTL: 64, Window: 2920, Options: "M"},
+	{OS: "Embedded RTOS", TTL: 64, Options: "M"},
+	{OS: "Embedded RTOS", TTL: 64, Options: ""},
+	{OS: "Embedded RTOS", TTL: 255, Options: ""},
+}
+
+// initialTTL rounds an observed TTL up to the value the sender started with.
+func initialTTL(ttl int) int {
+	for _, initial := range []int{32, 64, 128} {
+		if ttl <= initial {
+			return initial
+		}
+	}
+	return 255
+}
+
+// tcpFingerprint renders what a SYN-ACK reveals as "ttl:window:options",
+// e.g. "64:65160:M,S,T,N,W".
+func tcpFingerprint(ttl int, tcp *layers.TCP) string {
+	var opts []string
+	for _, opt := range tcp.Options {
+		switch opt.OptionType {
+		case layers.TCPOptionKindEndList:
+			opts = append(opts, "E")
+		case layers.TCPOptionKindNop:
+			opts = append(opts, "N")
+		case layers.TCPOptionKindMSS:
+			opts = append(opts, "M")
+		case layers.TCPOptionKindWindowScale:
+			opts = append(opts, "W")
+		case layers.TCPOptionKindSACKPermitted:
+			opts = append(opts, "S")
+		case layers.TCPOptionKindTimestamps:
+			opts = append(opts, "T")
+		default:
+			opts = append(opts, "?"+strconv.Itoa(int(opt.OptionType)))
+		}
+	}
+	return fmt.Sprintf("%d:%d:%s", initialTTL(ttl), tcp.Window, strings.Join(opts, ","))
+}
+
+// matchTCPSignature returns the OS whose signature fits a fingerprint best,
+// or "" if none does.
+func matchTCPSignature(fingerprint string) string {
+	parts := strings.SplitN(fingerprint, ":", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	ttl, _ := strconv.Atoi(parts[0])
+	window, _ := strconv.Atoi(parts[1])
+	for _, sig := range tcpSignatures {
+		if sig.TTL == ttl && sig.Options == parts[2] && (sig.Window == 0 || sig.Window == window) {
+			return sig.OS
+		}
+	}
+	return ""
+}
+
+// tcpSniffer collects the first SYN-ACK of every host while ports are
+// probed. It needs a raw socket (root or CAP_NET_RAW); operating systems
+// that do not hand TCP to raw sockets simply report nothing.
+type tcpSniffer struct {
+	conn *ipv4.RawConn
+	mu   sync.Mutex
+	seen map[string]string // IP to fingerprint
+	done chan struct{}
+}
+
+func startTCPSniffer() (*tcpSniffer, error) {
+	pc, err := net.ListenPacket("ip4:tcp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ipv4.NewRawConn(pc)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	t := &tcpSniffer{conn: conn, seen: make(map[string]string), done: make(chan struct{})}
+	go t.run()
+	return t, nil
+}
+
+func (t *tcpSniffer) run() {
+	defer close(t.done)
+	buf := make([]byte, 1500)
+	for {
+		hdr, payload, _, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			// Socket closed by stop
+			return
+		}
+		var tcp layers.TCP
+		if err := tcp.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil || !tcp.SYN || !tcp.ACK {
+			continue
+		}
+		ip := hdr.Src.String()
+		t.mu.Lock()
+		if _, ok := t.seen[ip]; !ok {
+			t.seen[ip] = tcpFingerprint(hdr.TTL, &tcp)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// stop closes the socket and returns the fingerprints collected.
+func (t *tcpSniffer) stop() map[string]string {
+	t.conn.Close()
+	<-t.done
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seen
+}
+
+// sniffSYNACKs starts watching for SYN-ACKs if enabled. Failures to open the
+// raw socket are logged once.
+func (p *tcpProbe) sniffSYNACKs() *tcpSniffer {
+	if !p.s.OSFingerprint {
+		return nil
+	}
+	sniffer, err := startTCPSniffer()
+	if err != nil {
+		if !p.sniffFailed {
+			log.Printf("TCP fingerprinting unavailable: %v", err)
+			p.sniffFailed = true
+		}
+		return nil
+	}
+	return sniffer
+}
+
+// setTCPFingerprint stores a device's SYN-ACK fingerprint and the OS it
+// matches. A guess from DHCP is kept, as it can tell iOS from macOS and
+// Android from Linux. Called with the scanner locked.
+func setTCPFingerprint(dev *models.Device, fp string) {
+	dev.TCPFingerprint = fp
+	if os := matchTCPSignature(fp); os != "" && (dev.OSSource == "" || dev.OSSource == osSourceTCP) {
+		dev.OSGuess, dev.OSSource = os, osSourceTCP
+	}
+}
@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"homenet/internal/models"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestInitialTTL(t *testing.T) {
+	for _, tc := range []struct{ ttl, want int }{
+		{1, 32}, {32, 32}, {33, 64}, {58, 64}, {64, 64}, {65, 128}, {117, 128}, {128, 128}, {129, 255}, {255, 255},
+	} {
+		if got := initialTTL(tc.ttl); got != tc.want {
+			t.Errorf("initialTTL(%d) = %d, want %d", tc.ttl, got, tc.want)
+		}
+	}
+}
+
+func TestTCPFingerprint(t *testing.T) {
+	opt := func(kinds ...layers.TCPOptionKind) []layers.TCPOption {
+		var list []layers.TCPOption
+		for _, k := range kinds {
+			list = append(list, layers.TCPOption{OptionType: k})
+		}
+		return list
+	}
+	for _, tc := range []struct {
+		name string
+		ttl  int
+		tcp  layers.TCP
+		want string
+	}{
+		{
+			name: "linux",
+			ttl:  63,
+			tcp: layers.TCP{Window: 65160, Options: opt(layers.TCPOptionKindMSS, layers.TCPOptionKindSACKPermitted,
+				layers.TCPOptionKindTimestamps, layers.TCPOptionKindNop, layers.TCPOptionKindWindowScale)},
+			want: "64:65160:M,S,T,N,W",
+		},
+		{
+			name: "darwin",
+			ttl:  64,
+			tcp: layers.TCP{Window: 65535, Options: opt(layers.TCPOptionKindMSS, layers.TCPOptionKindNop, layers.TCPOptionKindWindowScale,
+				layers.TCPOptionKindNop, layers.TCPOptionKindNop, layers.TCPOptionKindTimestamps, layers.TCPOptionKindSACKPermitted,
+				layers.TCPOptionKindEndList)},
+			want: "64:65535:M,N,W,N,N,T,S,E",
+		},
+		{
+			name: "unknown option",
+			ttl:  120,
+			tcp:  layers.TCP{Window: 8192, Options: opt(layers.TCPOptionKindMSS, 30)},
+			want: "128:8192:M,?30",
+		},
+		{
+			name: "no options",
+			ttl:  250,
+			tcp:  layers.TCP{Window: 1024},
+			want: "255:1024:",
+		},
+	} {
+		if got := tcpFingerprint(tc.ttl, &tc.tcp); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatchTCPSignature(t *testing.T) {
+	for _, tc := range []struct{ fp, want string }{
+		{"64:65160:M,S,T,N,W", "Linux"},
+		{"64:14480:M,S,T,N,W", "Linux (old kernel)"},
+		{"64:42340:M,S,T,N,W", "Linux"}, // Any window
+		{"64:65535:M,N,W,S,T", "FreeBSD"},
+		{"64:65535:M,N,W,N,N,T,S,E", "Darwin (macOS/iOS)"},
+		{"64:131072:M,N,W,N,N,T,S,E", "Darwin (macOS/iOS)"},
+		{"128:65535:M,N,W,S,T", "Windows"},
+		{"128:64240:M,N,W,N,N,S", "Windows"},
+		{"128:16384:M,N,N,S", "Windows (XP or older)"},
+		{"255:4128:M", "Cisco IOS"},
+		{"255:1024:M", "Embedded (lwIP)"},
+		{"64:5840:M", "Embedded (lwIP)"},
+		{"64:1024:M", "Embedded RTOS"},
+		{"255:512:", "Embedded RTOS"},
+
+		// Near misses
+		{"64:65535:M,N,W,S", ""},    // FreeBSD without timestamps
+		{"128:65160:M,S,T,N,W", ""}, // Linux layout with a Windows TTL
+		{"32:65535:M,N,W,S,T", ""},
+		{"64:4128:M,?30", ""},
+		{"64:65160", ""},
+		{"", ""},
+	} {
+		if got := matchTCPSignature(tc.fp); got != tc.want {
+			t.Errorf("matchTCPSignature(%q) = %q, want %q", tc.fp, got, tc.want)
+		}
+	}
+}
+
+// Every signature must be reachable: an earlier entry that matches all it
+// does would hide it.
+func TestTCPSignaturesNotShadowed(t *testing.T) {
+	for i, sig := range tcpSignatures {
+		for _, earlier := range tcpSignatures[:i] {
+			if earlier.TTL == sig.TTL && earlier.Options == sig.Options && (earlier.Window == 0 || earlier.Window == sig.Window) {
+				t.Errorf("signature %d (%+v) is hidden by %+v", i, sig, earlier)
+			}
+		}
+	}
+}
+
+func TestSetTCPFingerprint(t *testing.T) {
+	dev := &models.Device{}
+	setTCPFingerprint(dev, "128:65535:M,N,W,S,T")
+	if dev.OSGuess != "Windows" || dev.OSSource != osSourceTCP {
+		t.Errorf("got %q from %q, want Windows from tcp", dev.OSGuess, dev.OSSource)
+	}
+
+	// A later fingerprint replaces an earlier TCP guess
+	setTCPFingerprint(dev, "64:65160:M,S,T,N,W")
+	if dev.OSGuess != "Linux" || dev.TCPFingerprint != "64:65160:M,S,T,N,W" {
+		t.Errorf("got %q (%s), want Linux", dev.OSGuess, dev.TCPFingerprint)
+	}
+
+	// An unknown fingerprint is stored but leaves the guess alone
+	setTCPFingerprint(dev, "64:1:?30")
+	if dev.OSGuess != "Linux" || dev.TCPFingerprint != "64:1:?30" {
+		t.Errorf("unknown fingerprint: got %q (%s), want Linux kept", dev.OSGuess, dev.TCPFingerprint)
+	}
+
+	// DHCP can tell iOS from macOS, so it wins
+	dev = &models.Device{OSGuess: "iOS", OSSource: NameDHCP}
+	setTCPFingerprint(dev, "64:65535:M,N,W,N,N,T,S,E")
+	if dev.OSGuess != "iOS" || dev.TCPFingerprint == "" {
+		t.Errorf("got %q with fingerprint %q, want the DHCP guess kept and the fingerprint stored", dev.OSGuess, dev.TCPFingerprint)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package scanner
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenShared binds a UDP port with SO_REUSEADDR, so broadcasts to it are
+// delivered to every program listening, e.g. the host's own DHCP client.
+func listenShared(network string, addr string) (net.PacketConn, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}}
+	return lc.ListenPacket(context.Background(), network, addr)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package scanner
+
+import "net"
+
+func listenShared(network string, addr string) (net.PacketConn, error) {
+	return nil, errSharedUnsupported
+}